@@ -0,0 +1,173 @@
+package ping
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	apiKeyCollection = "api_keys"
+
+	// tokens are recognisable by the prefix, the rest is random
+	apiKeyPrefix = "ping_"
+)
+
+// API key scopes
+const (
+	ScopeRead      = "read"
+	ScopeReadWrite = "read-write"
+)
+
+// IAPIKeyRepository exposes the methods for the APIKeyRepository
+type IAPIKeyRepository interface {
+	Keys() ([]*APIKey, error)
+	FindByToken(token string) (*APIKey, error)
+	Create(*APIKey) (token string, err error)
+	Revoke(ID string) error
+	Close()
+}
+
+type APIKeyRepository struct {
+	Session *mgo.Session
+}
+
+func (repo *APIKeyRepository) Close() {
+	repo.Session.Close()
+}
+
+// APIKey is stored without the token, only its sha256 hash is kept; the token is shown once when the key is created
+type APIKey struct {
+	DocumentBase `bson:",inline"`
+	Name         string        `json:"name" bson:"name"`
+	Prefix       string        `json:"prefix" bson:"prefix"` // the beginning of the token, to recognise the key on the list
+	Hash         string        `json:"-" bson:"hash"`
+	Scope        string        `json:"scope" bson:"scope"`
+	Revoked      bool          `json:"revoked" bson:"revoked"`
+	Project      bson.ObjectId `json:"project,omitempty" bson:"project,omitempty"`
+	AllProjects  bool          `json:"all_projects" bson:"all_projects"` // instead of the project, set by the admin on purpose
+}
+
+// AllowedProjects returns the projects the key can work with; nil means all of them. The key without the project
+// (and without AllProjects) works with none
+func (k *APIKey) AllowedProjects() []bson.ObjectId {
+	if k.AllProjects {
+		return nil
+	}
+	if k.Project == "" {
+		return []bson.ObjectId{}
+	}
+
+	return []bson.ObjectId{k.Project}
+}
+
+type SingleAPIKey struct {
+	Data APIKey `json:"data"`
+}
+
+// Role translates the scope of the key into the user role: read-write keys are editors, read keys are viewers
+func (k *APIKey) Role() string {
+	if k.Scope == ScopeReadWrite {
+		return RoleEditor
+	}
+
+	return RoleViewer
+}
+
+func (r *APIKeyRepository) Keys() (keys []*APIKey, err error) {
+	err = r.collection().Find(nil).Sort("-_id").All(&keys)
+
+	return keys, dbError(err, "API key")
+}
+
+// FindByToken returns the active (not revoked) key matching the token
+func (r *APIKeyRepository) FindByToken(token string) (*APIKey, error) {
+	key := &APIKey{}
+	err := r.collection().Find(bson.M{"hash": HashToken(token), "revoked": false}).One(key)
+	if err != nil {
+		return nil, dbError(err, "API key")
+	}
+
+	return key, nil
+}
+
+// Create generates a new token for the key and returns it. It's the only moment the token is known
+func (r *APIKeyRepository) Create(key *APIKey) (token string, err error) {
+	if key.Name == "" {
+		return "", invalid("API key cannot be created without the name")
+	}
+	if key.Scope == "" {
+		key.Scope = ScopeRead
+	}
+	if key.Scope != ScopeRead && key.Scope != ScopeReadWrite {
+		return "", invalid("API key scope must be " + ScopeRead + " or " + ScopeReadWrite)
+	}
+	if key.Project == "" && !key.AllProjects {
+		return "", invalid("API key must have the project, or all_projects to work with all of them")
+	}
+	if key.Project != "" && key.AllProjects {
+		return "", invalid("API key cannot have both the project and all_projects")
+	}
+	if key.Project != "" && !key.Project.Valid() {
+		return "", invalid("API key project must be an ObjectId")
+	}
+
+	token, err = newToken(apiKeyPrefix)
+	if err != nil {
+		return "", err
+	}
+
+	key.Id = bson.NewObjectId()
+	key.Prefix = token[:len(apiKeyPrefix)+6]
+	key.Hash = HashToken(token)
+	key.Revoked = false
+
+	err = r.collection().Insert(key)
+	if err != nil {
+		return "", dbError(err, "API key")
+	}
+
+	return token, nil
+}
+
+// Revoke keeps the key on the list (to know who had access) but the key stops working
+func (r *APIKeyRepository) Revoke(id string) error {
+	oid, err := objectId(id, "API key")
+	if err != nil {
+		return err
+	}
+
+	return dbError(r.collection().UpdateId(oid, bson.M{"$set": bson.M{"revoked": true, "_modified": time.Now()}}), "API key")
+}
+
+// IsAPIKey tells if the token looks like an API key (and not eg. a session token)
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// newToken returns a random token starting with the prefix
+func newToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// HashToken is how the tokens are stored; they are long and random so a plain sha256 is enough
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// unexported methods
+func (repo *APIKeyRepository) collection() *mgo.Collection {
+	return repo.Session.DB("").C(apiKeyCollection)
+}
@@ -0,0 +1,160 @@
+package ping
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	auditCollection = "audit"
+)
+
+// Audit actions
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+// IAuditRepository exposes the methods for the AuditRepository. The audit is append only, there is no update nor delete
+type IAuditRepository interface {
+	Log(*AuditEntry) error
+	Entries(AuditFilter) ([]*AuditEntry, error)
+	Close()
+}
+
+// AuditRepository works only with the entries of the given Projects; nil means all of them
+type AuditRepository struct {
+	Session  *mgo.Session
+	Projects []bson.ObjectId
+}
+
+func (repo *AuditRepository) Close() {
+	repo.Session.Close()
+}
+
+// AuditEntry is a single change of the configuration: who (Actor) did what (Action) to which page (Target) and when
+type AuditEntry struct {
+	Id      bson.ObjectId     `json:"_id" bson:"_id"`
+	Time    time.Time         `json:"time" bson:"time"`
+	Actor   string            `json:"actor" bson:"actor"`
+	Action  string            `json:"action" bson:"action"`
+	Target  bson.ObjectId     `json:"target" bson:"target"`
+	Project bson.ObjectId     `json:"project,omitempty" bson:"project,omitempty"`
+	Changes map[string]Change `json:"changes" bson:"changes"` // the keys are the json names of the changed fields
+}
+
+// Change keeps the value of the field before and after the change
+type Change struct {
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
+
+// AuditFilter narrows down the audit entries; the empty fields are not taken into account
+type AuditFilter struct {
+	Target string
+	Actor  string
+	Limit  int
+}
+
+func (r *AuditRepository) Log(entry *AuditEntry) error {
+	entry.Id = bson.NewObjectId()
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	return dbError(r.collection().Insert(entry), "Audit entry")
+}
+
+// Entries returns the latest entries first
+func (r *AuditRepository) Entries(filter AuditFilter) (entries []*AuditEntry, err error) {
+	q := bson.M{}
+	if filter.Target != "" {
+		target, err := objectId(filter.Target, "Page")
+		if err != nil {
+			return nil, err
+		}
+		q["target"] = target
+	}
+	if filter.Actor != "" {
+		q["actor"] = filter.Actor
+	}
+
+	err = r.collection().Find(scope(q, "project", r.Projects)).Sort("-_id").Limit(filter.Limit).All(&entries)
+
+	return entries, dbError(err, "Audit entry")
+}
+
+// PageAudit builds the audit entry of the page change. before is nil for the created pages, after is nil for the deleted ones
+func PageAudit(actor, action string, before, after *Page) (*AuditEntry, error) {
+	entry := &AuditEntry{Actor: actor, Action: action}
+
+	for _, p := range []*Page{after, before} {
+		if p != nil {
+			entry.Target = p.Id
+			entry.Project = p.Project
+		}
+	}
+
+	changes, err := diff(before, after)
+	if err != nil {
+		return nil, err
+	}
+	entry.Changes = changes
+
+	return entry, nil
+}
+
+// diff compares the json representations of the two documents. The modification time is not a change on its own
+func diff(before, after interface{}) (map[string]Change, error) {
+	a, err := toMap(before)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toMap(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]Change{}
+	for k, v := range a {
+		if !reflect.DeepEqual(v, b[k]) {
+			changes[k] = Change{Before: v, After: b[k]}
+		}
+	}
+	for k, v := range b {
+		if _, ok := a[k]; !ok {
+			changes[k] = Change{Before: nil, After: v}
+		}
+	}
+
+	delete(changes, "_modified")
+
+	return changes, nil
+}
+
+func toMap(v interface{}) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	if rv := reflect.ValueOf(v); v == nil || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return m, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &m)
+
+	return m, err
+}
+
+// unexported methods
+func (repo *AuditRepository) collection() *mgo.Collection {
+	return repo.Session.DB("").C(auditCollection)
+}
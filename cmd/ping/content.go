@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/tomekwlod/ping"
+)
+
+const (
+	// above this number of lines we don't compute the similarity (it's quadratic), any change is reported
+	maxDiffLines = 2000
+	// the diff is sent via telegram so it has to be short
+	maxDiffLength = 3000
+	// the hash of the content when the selector/regex doesn't match anything; it's not a sha256, so it can't
+	// collide with the real content
+	unmatchedHash = "unmatched"
+)
+
+// errNoMatch is returned (wrapped) when the selector or the regex of the content check doesn't match the page
+var errNoMatch = errors.New("doesn't match anything")
+
+// contentChanged compares the watched region of the successful response with the one from the previous check.
+// It returns the diff when the change should be reported. The page hash/snapshot are updated in place
+// so the next check compares against the current content. The region which can't be found (the selector or
+// the regex stopped matching) is a change as well, reported once, until the region is back
+func contentChanged(page *ping.Page, body string) (changed bool, diff string, err error) {
+	cnf := page.ContentCheck
+
+	current, err := watchedContent(cnf, body)
+	if errors.Is(err, errNoMatch) {
+		if page.ContentHash == unmatchedHash {
+			return false, "", nil
+		}
+
+		page.ContentHash, page.ContentSnapshot = unmatchedHash, ""
+
+		return true, err.Error(), nil
+	}
+	if err != nil {
+		return
+	}
+
+	sum := sha256.Sum256([]byte(current))
+	hash := hex.EncodeToString(sum[:])
+
+	previousHash := page.ContentHash
+	previous := page.ContentSnapshot
+
+	page.ContentHash = hash
+	page.ContentSnapshot = ""
+	if cnf.Snapshot || cnf.Threshold > 0 {
+		page.ContentSnapshot = current
+	}
+
+	if previousHash == "" || previousHash == hash {
+		// first check (nothing to compare with) or nothing changed
+		return
+	}
+
+	if previousHash == unmatchedHash {
+		return true, "The watched content is back", nil
+	}
+
+	if previous == "" {
+		// no snapshot to compare with, only the hash
+		return true, "", nil
+	}
+
+	a, b := strings.Split(previous, "\n"), strings.Split(current, "\n")
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		return true, "", nil
+	}
+
+	lcs := lcsTable(a, b)
+	similarity := 2 * float64(lcs[0][0]) / float64(len(a)+len(b))
+	if cnf.Threshold > 0 && similarity >= cnf.Threshold {
+		return
+	}
+
+	diff = lineDiff(a, b, lcs)
+	if len(diff) > maxDiffLength {
+		// cut on the rune boundary, so the message stays valid utf-8
+		cut := maxDiffLength
+		for cut > 0 && !utf8.RuneStart(diff[cut]) {
+			cut--
+		}
+		diff = diff[:cut] + "\n..."
+	}
+
+	return true, diff, nil
+}
+
+// watchedContent cuts out the watched region and normalizes it: one trimmed line of text per line, no empty lines
+func watchedContent(cnf *ping.ContentCheck, body string) (string, error) {
+	content := body
+
+	if cnf.Selector != "" {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+
+		sel := doc.Find(cnf.Selector)
+		if sel.Length() == 0 {
+			return "", fmt.Errorf("Selector %s %w", cnf.Selector, errNoMatch)
+		}
+
+		parts := []string{}
+		sel.Each(func(_ int, s *goquery.Selection) {
+			parts = append(parts, s.Text())
+		})
+		content = strings.Join(parts, "\n")
+	}
+
+	if cnf.Regex != "" {
+		re, err := regexp.Compile(cnf.Regex)
+		if err != nil {
+			return "", err
+		}
+
+		m := re.FindStringSubmatch(content)
+		if m == nil {
+			return "", fmt.Errorf("Regex %s %w", cnf.Regex, errNoMatch)
+		}
+
+		content = m[0]
+		if len(m) > 1 {
+			content = m[1]
+		}
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// lcsTable[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+func lcsTable(a, b []string) [][]int {
+	t := make([][]int, len(a)+1)
+	for i := range t {
+		t[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				t[i][j] = t[i+1][j+1] + 1
+			} else if t[i+1][j] >= t[i][j+1] {
+				t[i][j] = t[i+1][j]
+			} else {
+				t[i][j] = t[i][j+1]
+			}
+		}
+	}
+
+	return t
+}
+
+// lineDiff lists the removed (-) and added (+) lines only, the unchanged ones are skipped
+func lineDiff(a, b []string, t [][]int) string {
+	var sb strings.Builder
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case t[i+1][j] >= t[i][j+1]:
+			sb.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		sb.WriteString("- " + a[i] + "\n")
+	}
+	for ; j < len(b); j++ {
+		sb.WriteString("+ " + b[j] + "\n")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/tomekwlod/ping"
+)
+
+const contentPage = `<html><body>
+<div class="price">  10
+  USD </div>
+<div class="price">20 USD</div>
+<p id="note">Version 1.2.3 released</p>
+</body></html>`
+
+func TestWatchedContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		cnf     ping.ContentCheck
+		body    string
+		want    string
+		noMatch bool
+	}{
+		{"whole body normalized", ping.ContentCheck{}, "  a   b \n\n c\n", "a b\nc", false},
+		{"selector", ping.ContentCheck{Selector: ".price"}, contentPage, "10\nUSD\n20 USD", false},
+		{"selector without match", ping.ContentCheck{Selector: ".missing"}, contentPage, "", true},
+		{"regex", ping.ContentCheck{Regex: `Version \S+`}, contentPage, "Version 1.2.3", false},
+		{"regex group", ping.ContentCheck{Regex: `Version (\S+)`}, contentPage, "1.2.3", false},
+		{"selector and regex", ping.ContentCheck{Selector: "#note", Regex: `\d+\.\d+`}, contentPage, "1.2", false},
+		{"regex without match", ping.ContentCheck{Selector: "#note", Regex: `price`}, contentPage, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := watchedContent(&tt.cnf, tt.body)
+			if tt.noMatch {
+				if err == nil || !strings.Contains(err.Error(), "doesn't match anything") {
+					t.Errorf("watchedContent() error = %v, want no match", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("watchedContent() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLcsTable(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want int
+	}{
+		{nil, nil, 0},
+		{[]string{"a"}, nil, 0},
+		{[]string{"a", "b", "c"}, []string{"a", "b", "c"}, 3},
+		{[]string{"a", "b", "c"}, []string{"x", "y"}, 0},
+		{[]string{"a", "b", "c", "d"}, []string{"b", "x", "d"}, 2},
+		{[]string{"a", "b", "a", "b"}, []string{"b", "a", "b", "a"}, 3},
+	}
+
+	for _, tt := range tests {
+		tab := lcsTable(tt.a, tt.b)
+		if len(tab) != len(tt.a)+1 || len(tab[0]) != len(tt.b)+1 {
+			t.Fatalf("lcsTable(%v, %v) is %dx%d", tt.a, tt.b, len(tab), len(tab[0]))
+		}
+		if tab[0][0] != tt.want {
+			t.Errorf("lcsTable(%v, %v)[0][0] = %d, want %d", tt.a, tt.b, tab[0][0], tt.want)
+		}
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want string
+	}{
+		{"same", []string{"a", "b"}, []string{"a", "b"}, ""},
+		{"added", []string{"a"}, []string{"a", "b"}, "+ b\n"},
+		{"removed", []string{"a", "b"}, []string{"b"}, "- a\n"},
+		{"replaced", []string{"a", "b", "c"}, []string{"a", "x", "c"}, "- b\n+ x\n"},
+		{"all new", []string{"a"}, []string{"x", "y"}, "- a\n+ x\n+ y\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lineDiff(tt.a, tt.b, lcsTable(tt.a, tt.b)); got != tt.want {
+				t.Errorf("lineDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentChanged(t *testing.T) {
+	hashOf := func(cnf ping.ContentCheck, body string) string {
+		p := &ping.Page{ContentCheck: &cnf}
+		contentChanged(p, body)
+		return p.ContentHash
+	}
+	snapshot := ping.ContentCheck{Snapshot: true}
+	price := ping.ContentCheck{Selector: ".price", Snapshot: true}
+
+	tests := []struct {
+		name     string
+		cnf      ping.ContentCheck
+		hash     string // the hash of the previous check
+		previous string // the snapshot of the previous check
+		body     string
+		changed  bool
+		diff     string
+		newHash  string
+	}{
+		{"first check", snapshot, "", "", "a\nb", false, "", hashOf(snapshot, "a\nb")},
+		{"nothing changed", snapshot, hashOf(snapshot, "a\nb"), "a\nb", "a\n  b ", false, "", hashOf(snapshot, "a\nb")},
+		{"changed", snapshot, hashOf(snapshot, "a\nb"), "a\nb", "a\nc", true, "- b\n+ c\n", hashOf(snapshot, "a\nc")},
+		{"changed without the snapshot", ping.ContentCheck{}, hashOf(ping.ContentCheck{}, "a"), "", "b", true, "", hashOf(ping.ContentCheck{}, "b")},
+		{"similar enough", ping.ContentCheck{Threshold: 0.5}, hashOf(snapshot, "a\nb\nc\nd"), "a\nb\nc\nd", "a\nb\nc\nx", false, "", hashOf(snapshot, "a\nb\nc\nx")},
+		{"below the threshold", ping.ContentCheck{Threshold: 0.9}, hashOf(snapshot, "a\nb\nc\nd"), "a\nb\nc\nd", "a\nb\nc\nx", true, "- d\n+ x\n", hashOf(snapshot, "a\nb\nc\nx")},
+		{"region gone", price, hashOf(price, contentPage), "10\nUSD\n20 USD", "<html></html>", true, "Selector .price doesn't match anything", unmatchedHash},
+		{"region still gone", price, unmatchedHash, "", "<html></html>", false, "", unmatchedHash},
+		{"region never found", price, "", "", "<html></html>", true, "Selector .price doesn't match anything", unmatchedHash},
+		{"region back", price, unmatchedHash, "", contentPage, true, "The watched content is back", hashOf(price, contentPage)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cnf := tt.cnf
+			page := &ping.Page{ContentCheck: &cnf, ContentHash: tt.hash, ContentSnapshot: tt.previous}
+
+			changed, diff, err := contentChanged(page, tt.body)
+			if err != nil {
+				t.Fatalf("contentChanged() error = %v", err)
+			}
+			if changed != tt.changed || diff != tt.diff {
+				t.Errorf("contentChanged() = %v, %q, want %v, %q", changed, diff, tt.changed, tt.diff)
+			}
+			if page.ContentHash != tt.newHash {
+				t.Errorf("contentChanged() hash = %s, want %s", page.ContentHash, tt.newHash)
+			}
+		})
+	}
+}
+
+func TestContentChangedLongDiff(t *testing.T) {
+	// multi-byte lines, so the cut falls inside a rune
+	a, b := []string{}, []string{}
+	for i := 0; i < 500; i++ {
+		a = append(a, strings.Repeat("ż", i%7+1))
+		b = append(b, strings.Repeat("ó", i%5+1))
+	}
+	cnf := ping.ContentCheck{Snapshot: true}
+	page := &ping.Page{ContentCheck: &cnf, ContentHash: "previous", ContentSnapshot: strings.Join(a, "\n")}
+
+	changed, diff, err := contentChanged(page, strings.Join(b, "\n"))
+	if err != nil || !changed {
+		t.Fatalf("contentChanged() = %v, %v, want a change", changed, err)
+	}
+	if len(diff) > maxDiffLength+len("\n...") || !strings.HasSuffix(diff, "\n...") {
+		t.Errorf("contentChanged() diff of %d bytes isn't cut", len(diff))
+	}
+	if !utf8.ValidString(diff) {
+		t.Error("contentChanged() diff isn't valid utf-8")
+	}
+}
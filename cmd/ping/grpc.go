@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/tomekwlod/ping"
+)
+
+const grpcTimeout = 30 * time.Second
+
+// grpcTest calls the standard grpc.health.v1.Health/Check service of the page Url (host:port).
+// The health status is translated into the http-like codes so the rest of the checker (pageUnstable,
+// updatePage, notifications) doesn't need to know what kind of check was made
+func grpcTest(ctx context.Context, page *ping.Page) (fetchResult, error) {
+	cnf := page.GRPC
+	if cnf == nil {
+		cnf = &ping.GRPCCheck{}
+	}
+
+	creds := insecure.NewCredentials()
+	if cnf.TLS {
+		creds = credentials.NewTLS(&tls.Config{InsecureSkipVerify: cnf.Insecure})
+	}
+
+	// the call carries the trace context of the check
+	conn, err := grpc.NewClient(page.Url, grpc.WithTransportCredentials(creds), grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
+	if err != nil {
+		return fetchResult{}, err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, grpcTimeout)
+	defer cancel()
+
+	if len(cnf.Metadata) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(cnf.Metadata))
+	}
+
+	// Starting the benchmark
+	timeStart := time.Now()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: cnf.Service})
+
+	// How long did it take
+	duration := time.Since(timeStart)
+
+	if err != nil {
+		// the rpc errors (also the connection ones) are the answer here, not a failure of the checker
+		st := status.Convert(err)
+
+		return fetchResult{URL: page.Url, Code: grpcErrorCode(st.Code()), Duration: duration, ContentType: "application/grpc", Content: st.Message()}, nil
+	}
+
+	return fetchResult{URL: page.Url, Code: grpcStatusCode(resp.GetStatus()), Duration: duration, ContentType: "application/grpc", Content: resp.GetStatus().String()}, nil
+}
+
+// grpcStatusCode maps the health check serving status onto the http status codes
+func grpcStatusCode(s healthpb.HealthCheckResponse_ServingStatus) int {
+	switch s {
+	case healthpb.HealthCheckResponse_SERVING:
+		return 200
+	case healthpb.HealthCheckResponse_NOT_SERVING:
+		return 503
+	case healthpb.HealthCheckResponse_SERVICE_UNKNOWN:
+		return 404
+	}
+
+	return 500
+}
+
+// grpcErrorCode maps the rpc error codes onto the http status codes
+func grpcErrorCode(c codes.Code) int {
+	switch c {
+	case codes.NotFound:
+		// the server doesn't know the requested service
+		return 404
+	case codes.Unimplemented:
+		// the server doesn't implement the health service at all
+		return 501
+	case codes.Unavailable:
+		return 503
+	case codes.DeadlineExceeded:
+		return 504
+	case codes.Unauthenticated:
+		return 401
+	case codes.PermissionDenied:
+		return 403
+	}
+
+	return 500
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/tomekwlod/ping"
+)
+
+// startHealthServer serves the standard health service on a loopback port and returns its address
+func startHealthServer(t *testing.T, withHealth bool) (string, *health.Server) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	if withHealth {
+		healthpb.RegisterHealthServer(srv, hs)
+	}
+
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String(), hs
+}
+
+func TestGrpcTest(t *testing.T) {
+	addr, hs := startHealthServer(t, true)
+	hs.SetServingStatus("up", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus("down", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	noHealth, _ := startHealthServer(t, false)
+
+	// nothing listens on the port of the closed listener
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := lis.Addr().String()
+	lis.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		service string
+		code    int
+	}{
+		{"serving", addr, "up", 200},
+		{"whole server", addr, "", 200},
+		{"not serving", addr, "down", 503},
+		{"unknown service", addr, "missing", 404},
+		{"no health service", noHealth, "", 501},
+		{"dial error", closed, "", 503},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := &ping.Page{Url: tt.url, Type: ping.CheckGRPC, GRPC: &ping.GRPCCheck{Service: tt.service}}
+
+			res, err := grpcTest(context.Background(), page)
+			if err != nil {
+				t.Fatalf("grpcTest() error = %v", err)
+			}
+			if res.Code != tt.code {
+				t.Errorf("grpcTest() code = %d (%s), want %d", res.Code, res.Content, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tomekwlod/ping"
+	"github.com/tomekwlod/ping/db"
+	"github.com/tomekwlod/ping/importer"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// runImport is the `ping import openapi|k8s -f <file>` subcommand. It creates (or updates) the monitors found in
+// an OpenAPI 3 document or in the Kubernetes Ingress/Service manifests; the other pages are never deleted
+func runImport(args []string) error {
+	if len(args) == 0 || (args[0] != "openapi" && args[0] != "k8s") {
+		return errors.New("usage: ping import openapi|k8s -f <file> [-base <url>] [-dry-run] [-project <id>]")
+	}
+	kind := args[0]
+
+	fs := flag.NewFlagSet("import "+kind, flag.ExitOnError)
+	file := fs.String("f", "", "OpenAPI document, or a manifest file/directory for k8s")
+	base := fs.String("base", "", "base url of the api, if the OpenAPI document has no absolute server url")
+	dryRun := fs.Bool("dry-run", false, "print the plan only")
+	project := fs.String("project", "", "id of the project the monitors belong to")
+	fs.Parse(args[1:])
+
+	if *file == "" {
+		return errors.New("the -f option is required")
+	}
+
+	var monitors []ping.Monitor
+	var err error
+
+	switch kind {
+	case "openapi":
+		var data []byte
+		data, err = ioutil.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+
+		monitors, err = importer.OpenAPI(data, *base)
+		if err != nil {
+			return err
+		}
+	case "k8s":
+		monitors, err = importManifests(*file)
+		if err != nil {
+			return err
+		}
+	}
+
+	mgoSession, err := db.CreateSession(mgoHost())
+	if err != nil {
+		return fmt.Errorf("Cannot connect to Mongodb: %v", err)
+	}
+	defer mgoSession.Close()
+
+	var projects []bson.ObjectId
+	if *project != "" {
+		if !bson.IsObjectIdHex(*project) {
+			return fmt.Errorf("Invalid project id %s", *project)
+		}
+		projects = []bson.ObjectId{bson.ObjectIdHex(*project)}
+
+		for i := range monitors {
+			monitors[i].Project = projects[0]
+		}
+	}
+
+	return syncMonitors(&service{session: mgoSession}, monitors, projects, false, *dryRun)
+}
+
+// importManifests reads the manifest file or all the *.yml/*.yaml files of the directory (recursively)
+func importManifests(path string) ([]ping.Monitor, error) {
+	monitors := []ping.Monitor{}
+
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || (p != path && !strings.HasSuffix(p, ".yml") && !strings.HasSuffix(p, ".yaml")) {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		m, err := importer.Kubernetes(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		monitors = append(monitors, m...)
+
+		return nil
+	})
+
+	return monitors, err
+}
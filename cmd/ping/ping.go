@@ -13,31 +13,43 @@ https://github.com/golang/tour/blob/master/solutions/webcrawler.go -> an example
 */
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"net/http"
-	"net/smtp"
+	"net/http/httptrace"
 	"os"
 	"strconv"
-	"strings"
 	"time"
 
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
-
 	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 
 	"github.com/tomekwlod/ping"
 	"github.com/tomekwlod/ping/db"
+	"github.com/tomekwlod/ping/notify"
+	"github.com/tomekwlod/ping/telemetry"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// probeTransport makes the requests of the checks; they carry the trace context (traceparent) of their check
+var probeTransport = otelhttp.NewTransport(http.DefaultTransport)
+
 type fetchResult struct {
 	URL         string
 	Code        int
 	Duration    time.Duration
 	ContentType string
 	Content     string
+	Steps       []ping.StepResult
+	Timing      *ping.Timing
+	TLSExpiry   *time.Time
 }
 
 type response struct {
@@ -62,13 +74,23 @@ func mgoHost() (host string) {
 	return
 }
 
+// probeName is the location of this checker (PING_PROBE), its results are tagged with it
+func probeName() string {
+	if p := os.Getenv("PING_PROBE"); p != "" {
+		return p
+	}
+
+	return ping.DefaultProbe
+}
+
 var (
-	l *log.Logger
+	l     *slog.Logger
+	probe string
 )
 
 type service struct {
-	session *mgo.Session
-	telbot  *tgbotapi.BotAPI
+	session   *mgo.Session
+	notifiers []notify.Notifier
 }
 
 // functions for the service struct
@@ -78,6 +100,34 @@ func (s *service) getPageRepo() ping.IPageRepository {
 func (s *service) getPageEntryRepo() ping.IPageEntryRepository {
 	return &ping.PageEntryRepository{Session: s.session.Clone()}
 }
+func (s *service) getContactGroupRepo(projects []bson.ObjectId) ping.IContactGroupRepository {
+	return &ping.ContactGroupRepository{Session: s.session.Clone(), Projects: projects}
+}
+func (s *service) getIncidentRepo() ping.IIncidentRepository {
+	return &ping.IncidentRepository{Session: s.session.Clone()}
+}
+
+// notify sends the message to the contact groups of the page; the notifiers' defaults if the page has no groups.
+// Only the groups of the project of the page are notified
+func (s *service) notify(page *ping.Page, m notify.Message) error {
+	if len(page.ContactGroups) > 0 {
+		projects := []bson.ObjectId{}
+		if page.Project != "" {
+			projects = append(projects, page.Project)
+		}
+		repo := s.getContactGroupRepo(projects)
+		defer repo.Close()
+
+		groups, err := repo.FindIds(page.ContactGroups)
+		if err != nil {
+			return err
+		}
+
+		m.ChatIDs, m.Emails = notify.Recipients(groups)
+	}
+
+	return notify.Broadcast(s.notifiers, m)
+}
 
 // // init is invoked before main()
 // func init() {
@@ -95,32 +145,52 @@ func (s *service) getPageEntryRepo() ping.IPageEntryRepository {
 // }
 
 func main() {
-	// definig the logger & the log file
-	file, err := os.OpenFile("log/ping.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	// subcommands
+	if len(os.Args) > 1 && os.Args[1] == "sync" {
+		if err := runSync(os.Args[2:]); err != nil {
+			log.Fatalln(err)
+		}
+
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(os.Args[2:]); err != nil {
+			log.Fatalln(err)
+		}
+
+		return
+	}
+
+	// definig the logger & the log files
+	logger, files, err := telemetry.NewLogger("ping")
+	if err != nil {
+		log.Fatalln("Failed to open log file", err)
+	}
+	defer files.Close()
+	l = logger
+
+	shutdown, err := telemetry.StartTracing("ping-checker")
 	if err != nil {
-		l.Fatalln("Failed to open log file", err)
+		log.Fatalln("Cannot start the tracing", err)
 	}
-	multi := io.MultiWriter(file, os.Stdout)
-	l = log.New(multi, "", log.Ldate|log.Ltime|log.Lshortfile)
+	defer shutdown()
 
 	// definging the mongodb session
 	mgoSession, err := db.CreateSession(mgoHost())
-	defer mgoSession.Close()
 	if err != nil {
-		l.Panic("Cannot connect to Mongodb: ", err)
+		fatal("cannot connect to mongodb", err)
 	}
+	defer mgoSession.Close()
 
-	bot, err := tgbotapi.NewBotAPI(os.Getenv("TELEGRAM_TOKEN"))
+	notifiers, err := notify.FromEnv()
 	if err != nil {
-		log.Fatalln(err)
+		fatal("cannot configure the notifiers", err)
 	}
 
-	log.Printf("Authorized on account %s", bot.Self.UserName)
-
-	// combine the datastore session and the logger into one struct
+	// combine the datastore session and the notifiers into one struct
 	s := &service{
-		session: mgoSession,
-		telbot:  bot,
+		session:   mgoSession,
+		notifiers: notifiers,
 	}
 
 	// do i have to open two sessions here?
@@ -128,18 +198,39 @@ func main() {
 	defer pageRepo.Close()                // close the session defer
 	pageEntryRepo := s.getPageEntryRepo() // clone the session
 	defer pageEntryRepo.Close()           // close the session defer
+	incidentRepo := s.getIncidentRepo()
+	defer incidentRepo.Close()
+
+	// the deleted pages are purged (with their history) after PING_PURGE_DAYS days
+	if days, _ := strconv.Atoi(os.Getenv("PING_PURGE_DAYS")); days > 0 {
+		n, err := pageRepo.Purge(time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			l.Error("cannot purge the deleted pages", "error", err)
+		} else if n > 0 {
+			l.Info("purged the deleted pages", "count", n)
+		}
+	}
+
+	probe = probeName()
+	if !ping.ValidProbeName(probe) {
+		fatal("invalid probe name", fmt.Errorf("PING_PROBE %q cannot contain the dots and the dollars", probe))
+	}
 
-	pages, err := pageRepo.PagesForPing()
+	pages, err := pageRepo.PagesForPing(probe)
 	if err != nil {
-		l.Panic(err)
+		fatal("cannot find the pages to check", err)
 	}
 
 	if len(pages) == 0 {
-		l.Println("No queued pages found")
+		l.Info("no queued pages found")
 
 		return
 	}
 
+	// one span for the whole run, with the checks inside
+	ctx, run := telemetry.Tracer().Start(context.Background(), "checker.run", trace.WithAttributes(attribute.Int("pages", len(pages))))
+	defer run.End()
+
 	// When we know the number of goroutines to use we might count them to know when to finish. But then the waitgroup
 	// is superfluous, confusing and overcomplicated. WaitGroups are more useful for doing different tasks in parallel, or when
 	// we don't know how many goroutines we actually need (eg. recursive going through the directories)
@@ -156,7 +247,7 @@ func main() {
 	for _, page := range pages {
 		// we start a goroutine which expects a string parameter
 		go func(p *ping.Page) {
-			res, err := urlTest(p.Url)
+			res, err := tracedCheck(ctx, p)
 
 			// we could do the rest of the work here, but for the learning purposes i used the channels
 			// to do it outside of the goroutine
@@ -181,75 +272,212 @@ func main() {
 		// 	continue
 		// }
 
-		l.Printf("\tCODE:%d\t%s\t%s\n", r.result.Code, r.result.Duration, r.result.URL)
+		logCheck(r)
 
-		// sending an email only if the status from the result doesn't match the last page status
-		if pageUnstable(r) == true {
-			//                      DISABLED TEMPORARY DUE TO THE BARRACUDA BAN
-			// 	sendEmail(r.page, r.result.Code)
-			msg := tgbotapi.NewMessageToChannel(os.Getenv("TELEGRAM_CHATID"), fmt.Sprintf("[PING] url:%s is now returning code: %d", r.page.Url, r.result.Code))
+		// watching the content of the successful responses for the unexpected changes; the new content is saved
+		// with the check, the change is reported only after that
+		contentChange, contentDiff, contentHash := false, "", r.page.ContentHash
+		if r.page.ContentCheck != nil && r.page.Up(r.result.Code) {
+			changed, diff, err := contentChanged(r.page, r.result.Content)
+			if err != nil {
+				l.Warn("content check failed", "page", r.page.Id.Hex(), "url", r.page.Url, "error", err)
+			}
+			contentChange, contentDiff = changed, diff
+		}
 
-			_, e := s.telbot.Send(msg)
+		// one page failing to save doesn't stop the others
+		page, e := updatePage(r, pageRepo, pageEntryRepo)
+		if errors.Is(e, ping.ErrNotFound) {
+			l.Info("page deleted during the run, skipped", "page", r.page.Id.Hex())
+			continue
+		}
+		if e != nil {
+			l.Error("cannot save the result of the check", "page", r.page.Id.Hex(), "error", e)
+		}
+		if page == nil {
+			continue
+		}
+
+		// the hash this probe saw before is compared (and swapped) in the db, so with many probes the change
+		// is reported once
+		if r.page.ContentHash != contentHash {
+			saved, e := pageRepo.SetContent(page.Id, contentHash, r.page.ContentHash, r.page.ContentSnapshot)
 			if e != nil {
-				log.Fatalln(e)
+				l.Error("cannot save the content of the page", "page", page.Id.Hex(), "error", e)
 			}
+
+			if saved && contentChange {
+				subject := fmt.Sprintf("[PING] url:%s content has changed", page.Url)
+				if r.page.ContentHash == unmatchedHash {
+					subject = fmt.Sprintf("[PING] url:%s watched content is gone", page.Url)
+				}
+
+				e := s.notify(page, notify.Message{Subject: subject, Text: contentDiff})
+				if e != nil {
+					l.Error("cannot send the notification", "page", page.Id.Hex(), "error", e)
+				}
+			}
+		}
+
+		code, unstable := pageUnstable(page)
+		if code == page.LastStatus {
+			continue
+		}
+
+		// with many probes only the one which changes the status sends the alerts
+		changed, e := pageRepo.SetStatus(page.Id, page.LastStatus, code)
+		if e != nil {
+			l.Error("cannot change the status of the page", "page", page.Id.Hex(), "error", e)
 		}
 
-		updatePage(r, pageRepo, pageEntryRepo)
+		// sending an email only if the status of the page doesn't match the last page status
+		if changed && unstable {
+			e := s.notify(page, statusMessage(page, code))
+			if e != nil {
+				l.Error("cannot send the notification", "page", page.Id.Hex(), "error", e)
+			}
+
+			// the auto-detected incident is open as long as the page is down
+			if !page.Up(code) {
+				e = incidentRepo.OpenAuto(page, code)
+			} else {
+				e = incidentRepo.ResolveAuto(page)
+			}
+			if e != nil {
+				l.Error("cannot update the incident", "page", page.Id.Hex(), "error", e)
+			}
+		}
 	}
 }
 
-func pageUnstable(r response) bool {
-	if (r.page.LastStatus == 200 && r.result.Code != 200) || (r.page.LastStatus != 200 && r.result.Code == 200) {
-		return true
+// pageUnstable returns the status of the page by the quorum of its locations (see the QuorumStatus)
+// and tells if the page went down or came back. Without the quorum the last status stays
+func pageUnstable(page *ping.Page) (int, bool) {
+	code, ok := page.QuorumStatus(time.Now())
+	if !ok {
+		return page.LastStatus, false
+	}
+
+	if page.Up(page.LastStatus) != page.Up(code) {
+		return code, true
 	}
 
-	return false
+	return code, false
 }
 
-func updatePage(r response, pageRepo ping.IPageRepository, pageEntryRepo ping.IPageEntryRepository) {
+// updatePage saves the check of the probe and returns the saved page, with the checks of the other probes
+func updatePage(r response, pageRepo ping.IPageRepository, pageEntryRepo ping.IPageEntryRepository) (*ping.Page, error) {
 	content := ""
-	if r.result.Code != 200 {
+	if !r.page.Up(r.result.Code) {
 		content = r.result.Content
 	}
 
-	pageEntry := &ping.PageEntry{Code: r.result.Code, Load: r.result.Duration.Seconds(), Page: r.page.Id}
-	pageEntry.SetInsertDefaults(time.Now())
-
-	err := pageEntryRepo.Create(pageEntry)
-	if err != nil {
-		l.Panicln(err)
-	}
-
 	page := r.page
-	page.LastStatus = r.result.Code
-	page.Modified = time.Now()
+	page.Checked = time.Now()
+	page.LastLoad = r.result.Duration.Seconds()
+	if r.result.TLSExpiry != nil {
+		page.TLSExpiry = r.result.TLSExpiry
+	}
 	page.NextPing = time.Now().Add(time.Hour*time.Duration(0) + time.Minute*time.Duration(page.Interval) + time.Second*time.Duration(0))
 	if content != "" {
 		// update content only when error appears
 		page.Content = content
 	}
 
-	err = pageRepo.Upsert(page)
+	state := ping.ProbeState{Code: r.result.Code, Load: page.LastLoad, Checked: page.Checked, NextPing: page.NextPing}
+
+	// the page is saved first, so there is no history of the page deleted during the run
+	saved, err := pageRepo.SaveCheck(page, probe, state)
 	if err != nil {
-		l.Panic(err)
+		return nil, err
+	}
+
+	pageEntry := &ping.PageEntry{Code: r.result.Code, Up: r.page.Up(r.result.Code), Load: r.result.Duration.Seconds(), Page: r.page.Id, Probe: probe, Steps: r.result.Steps, Timing: r.result.Timing}
+	pageEntry.SetInsertDefaults(time.Now())
+
+	return saved, pageEntryRepo.Create(pageEntry)
+}
+
+// tracedCheck is the check of the page in its own span
+func tracedCheck(ctx context.Context, p *ping.Page) (fetchResult, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "check", trace.WithAttributes(
+		attribute.String("page.id", p.Id.Hex()),
+		attribute.String("url.full", p.Url),
+		attribute.String("check.type", p.Type),
+		attribute.String("check.probe", probe),
+	))
+	defer span.End()
+
+	res, err := check(ctx, p)
+
+	span.SetAttributes(attribute.Int("check.code", res.Code), attribute.Float64("check.duration", res.Duration.Seconds()))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if !p.Up(res.Code) {
+		span.SetStatus(codes.Error, "code "+strconv.Itoa(res.Code))
+	}
+
+	return res, err
+}
+
+// logCheck logs the result of the check; the failed ones as the warnings
+func logCheck(r response) {
+	level := slog.LevelInfo
+	if !r.page.Up(r.result.Code) {
+		level = slog.LevelWarn
+	}
+
+	attrs := []any{"page", r.page.Id.Hex(), "url", r.page.Url, "probe", probe, "code", r.result.Code, "duration", r.result.Duration.Seconds()}
+	if r.err != nil {
+		attrs = append(attrs, "error", r.err)
 	}
+
+	l.Log(context.Background(), level, "check", attrs...)
+}
+
+// fatal logs the error and stops the checker; only for the errors which leave nothing to check
+func fatal(msg string, err error) {
+	l.Error(msg, "error", err)
+	os.Exit(1)
 }
 
-func urlTest(url string) (fetchResult, error) {
+// check runs the probe matching the type of the page; its requests are the children of the span in ctx
+func check(ctx context.Context, p *ping.Page) (res fetchResult, err error) {
+	switch p.Type {
+	case ping.CheckGRPC:
+		res, err = grpcTest(ctx, p)
+	case ping.CheckScenario:
+		res, err = scenarioTest(ctx, p)
+	case ping.CheckStatusPage:
+		res, err = statusPageTest(ctx, p)
+	default:
+		res, err = urlTest(ctx, p.Url)
+	}
+
+	// the real code is kept, the page tells if it's the successful one (eg. 204), see the Up
+	if err == nil && p.Up(res.Code) && len(p.Latency) > 0 {
+		assertLatency(p.Latency, &res)
+	}
+
+	return
+}
+
+func urlTest(ctx context.Context, url string) (fetchResult, error) {
 	// if !strings.Contains(url, "http://") {
 	// 	url = "http://" + url
 	// }
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return fetchResult{}, err
 	}
 
 	// Starting the benchmark
-	timeStart := time.Now()
+	t := &tracer{start: time.Now()}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), t.clientTrace()))
 
-	resp, err := http.DefaultTransport.RoundTrip(req)
+	resp, err := probeTransport.RoundTrip(req)
 	if err != nil {
 		return fetchResult{}, err
 	}
@@ -263,115 +491,37 @@ func urlTest(url string) (fetchResult, error) {
 	contentType := resp.Header.Get("Content-Type")
 
 	// How long did it take
-	duration := time.Since(timeStart)
+	end := time.Now()
+	duration := end.Sub(t.start)
 
-	return fetchResult{url, resp.StatusCode, duration, contentType, string(content)}, nil
+	return fetchResult{URL: url, Code: resp.StatusCode, Duration: duration, ContentType: contentType, Content: string(content), Timing: t.timing(end), TLSExpiry: t.expiry()}, nil
 }
 
-func sendEmail(page *ping.Page, statusCode int) {
-	url := page.Url
-
-	// this should go to the main function to load it only once
-	cnf, err := ping.LoadConfig()
-	if err != nil {
-		l.Fatalln(err)
-	}
-
-	if cnf.SMTP_Email == "" || cnf.SMTP_Server == "" || cnf.SMTP_Port == "" || len(cnf.SMTP_Emails) == 0 {
-		l.Println("SMTP credentials not set. Skiping email notification")
-		return
-	}
-
-	body := ""
-	subject := ""
-	if statusCode != 200 {
-		message := "Warning"
-		if statusCode == 500 {
-			message = "Alert"
-		} else if statusCode == 404 {
-			message = "Fatal Error"
-		}
+// statusMessage tells that the page went down (with the instructions from its description) or that it's back
+func statusMessage(page *ping.Page, statusCode int) notify.Message {
+	if !page.Up(statusCode) {
+		return notify.Message{
+			Subject: fmt.Sprintf("[PING] url:%s is now returning code: %d", page.Url, statusCode),
+			Text: `Incident OPENED for "` + page.Name + `"!
 
-		subject = "Incident [" + strconv.Itoa(statusCode) + "] for " + url
-		body = `Incident OPENED for "` + page.Name + `"!
-		
 Find the details below and instructions to fix the issue
 
-Url: ` + url + `
-Message: ` + message + `
+Url: ` + page.Url + `
 Status code: ` + strconv.Itoa(statusCode) + `
 Description: ` + page.Description + `
 
 You can see all the endpoints here: ` + os.Getenv("GUI_ADDR") + `
 
-You will be notified when the page goes live back again.
-
-Ping®
-`
-	} else {
-		subject = "Incident CLOSED for " + url
-		body = `Incident CLOSED for ` + page.Name + `
-
-Url: ` + url + `
-Downtime: ...
-
-You can see all the endpoints here: ` + os.Getenv("GUI_ADDR") + `
-
-Ping®
-`
-	}
-
-	// Setup headers
-	headers := make(map[string]string)
-	headers["From"] = cnf.SMTP_Email
-	headers["To"] = strings.Join(cnf.SMTP_Emails, ",")
-	headers["Subject"] = subject
-
-	// Setup message
-	message := ""
-	for k, v := range headers {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
-	}
-	message += "\r\n" + body
-
-	// Connect to the SMTP Server
-	servername := cnf.SMTP_Server + ":" + cnf.SMTP_Port
-	l.Println(servername)
-	// host, _, _ := net.SplitHostPort(servername)
-
-	c, err := smtp.Dial(servername)
-	if err != nil {
-		l.Panic(err)
-	}
-
-	// To && From
-	if err = c.Mail(cnf.SMTP_Email); err != nil {
-		l.Panic(err)
-	}
-
-	for _, email := range cnf.SMTP_Emails {
-		if err = c.Rcpt(email); err != nil {
-			l.Panic(err)
+You will be notified when the page goes live back again.`,
 		}
 	}
 
-	// Data
-	w, err := c.Data()
-	if err != nil {
-		l.Panic(err)
-	}
+	return notify.Message{
+		Subject: fmt.Sprintf("[PING] url:%s is now returning code: %d", page.Url, statusCode),
+		Text: `Incident CLOSED for "` + page.Name + `"
 
-	_, err = w.Write([]byte(message))
-	if err != nil {
-		l.Panic(err)
-	}
+Url: ` + page.Url + `
 
-	err = w.Close()
-	if err != nil {
-		l.Panic(err)
+You can see all the endpoints here: ` + os.Getenv("GUI_ADDR"),
 	}
-
-	c.Quit()
-
-	fmt.Println("Notification sent to " + strings.Join(cnf.SMTP_Emails, ", "))
 }
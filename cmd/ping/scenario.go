@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomekwlod/ping"
+)
+
+const (
+	// the status reported when a response came back with an expected code but didn't pass the other assertions
+	codeAssertionFailed = 417
+
+	scenarioTimeout = 30 * time.Second
+)
+
+// scenarioTest runs the page steps one by one, sharing the cookies and the extracted values between them.
+// The redirects are not followed, the step gets the redirect itself (eg. to check its status and extract
+// its Location). The scenario stops on the first failing step; the code of the whole scenario is 200 only
+// if all the steps passed
+func scenarioTest(ctx context.Context, page *ping.Page) (fetchResult, error) {
+	client, err := scenarioClient()
+	if err != nil {
+		return fetchResult{}, err
+	}
+
+	res := fetchResult{URL: page.Url, Code: 200}
+	vars := map[string]string{}
+
+	for i, step := range page.Steps {
+		if step.Name == "" {
+			step.Name = "step " + strconv.Itoa(i+1)
+		}
+
+		sr, content := runStep(ctx, client, step, vars)
+
+		res.Steps = append(res.Steps, sr)
+		res.Duration += time.Duration(sr.Load * float64(time.Second))
+		// the phases of the scenario are the phases of all its steps together
+		res.Timing = addTiming(res.Timing, sr.Timing)
+
+		if !sr.Passed {
+			res.Code = sr.Code
+			if sr.Code > 0 && sr.Code < 400 {
+				// the server answered fine, it's our assertion which didn't pass
+				res.Code = codeAssertionFailed
+			}
+			res.Content = fmt.Sprintf("%s: %s\n\n%s", sr.Name, sr.Error, content)
+
+			break
+		}
+	}
+
+	return res, nil
+}
+
+// scenarioClient is the client of a single run of the scenario, with its own cookies
+func scenarioClient() (*http.Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Jar:       jar,
+		Timeout:   scenarioTimeout,
+		Transport: probeTransport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}, nil
+}
+
+// runStep makes the request of a single step, checks the assertions and extracts the values for the next steps
+func runStep(ctx context.Context, client *http.Client, step ping.Step, vars map[string]string) (ping.StepResult, string) {
+	replacer := placeholders(vars, nil)
+
+	// the values can have any characters, in the url they're escaped
+	sr := ping.StepResult{Name: step.Name, Url: placeholders(vars, urlEscape).Replace(step.Url)}
+
+	method := step.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, sr.Url, strings.NewReader(replacer.Replace(step.Body)))
+	if err != nil {
+		sr.Error = err.Error()
+		return sr, ""
+	}
+	for k, v := range step.Headers {
+		req.Header.Set(k, replacer.Replace(v))
+	}
+
+	t := &tracer{start: time.Now()}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), t.clientTrace()))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		sr.Load = time.Since(t.start).Seconds()
+		sr.Error = err.Error()
+		return sr, ""
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	end := time.Now()
+	sr.Load = end.Sub(t.start).Seconds()
+	sr.Timing = t.timing(end)
+	sr.Code = resp.StatusCode
+	if err != nil {
+		sr.Error = err.Error()
+		return sr, ""
+	}
+	content := string(body)
+
+	expected := step.Status
+	if expected == 0 {
+		expected = 200
+	}
+	if resp.StatusCode != expected {
+		sr.Error = fmt.Sprintf("expected status %d, got %d", expected, resp.StatusCode)
+		return sr, content
+	}
+
+	if step.Contains != "" && !strings.Contains(content, step.Contains) {
+		sr.Error = fmt.Sprintf("response doesn't contain %q", step.Contains)
+		return sr, content
+	}
+
+	for _, e := range step.Extract {
+		v, err := extract(e, resp, body)
+		if err != nil {
+			sr.Error = fmt.Sprintf("cannot extract %q: %s", e.Name, err)
+			return sr, content
+		}
+
+		vars[e.Name] = v
+	}
+
+	sr.Passed = true
+
+	return sr, content
+}
+
+// placeholders replaces every {{name}} with the value extracted earlier, escaped by the escape if it's not nil
+func placeholders(vars map[string]string, escape func(string) string) *strings.Replacer {
+	pairs := []string{}
+	for k, v := range vars {
+		if escape != nil {
+			v = escape(v)
+		}
+		pairs = append(pairs, "{{"+k+"}}", v)
+	}
+
+	return strings.NewReplacer(pairs...)
+}
+
+// urlEscape escapes the value for both the path and the query of the url
+func urlEscape(v string) string {
+	return strings.ReplaceAll(url.QueryEscape(v), "+", "%20")
+}
+
+func extract(e ping.Extract, resp *http.Response, body []byte) (string, error) {
+	switch e.From {
+	case "header":
+		v := resp.Header.Get(e.Key)
+		if v == "" {
+			return "", fmt.Errorf("header %s not found", e.Key)
+		}
+
+		return v, nil
+	case "cookie":
+		for _, c := range resp.Cookies() {
+			if c.Name == e.Key {
+				return c.Value, nil
+			}
+		}
+
+		return "", fmt.Errorf("cookie %s not found", e.Key)
+	case "json":
+		return jsonPath(body, e.Key)
+	}
+
+	return "", fmt.Errorf("unknown source %q", e.From)
+}
+
+// jsonPath walks through the decoded json using the dotted path, eg. data.items.0.token
+func jsonPath(body []byte, path string) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(string(body)))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", err
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			val, ok := node[key]
+			if !ok {
+				return "", fmt.Errorf("key %s not found", key)
+			}
+			v = val
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", fmt.Errorf("index %s out of range", key)
+			}
+			v = node[i]
+		default:
+			return "", fmt.Errorf("cannot walk into %s", key)
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case json.Number:
+		return val.String(), nil
+	case nil:
+		return "", fmt.Errorf("value of %s is null", path)
+	}
+
+	// objects, arrays and booleans are passed as json
+	b, err := json.Marshal(v)
+
+	return string(b), err
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tomekwlod/ping"
+)
+
+// scenarioServer logs in (a cookie, a header and a json token), redirects, fails and echoes the request back
+func scenarioServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t"})
+		w.Header().Set("X-Token", "header-token")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"token":"a b/c&d","items":[{"id":7}]}}`))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+	})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "q=%s header=%s body=%s", r.URL.Query().Get("q"), r.Header.Get("X-Q"), body)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestRunStep(t *testing.T) {
+	srv := scenarioServer(t)
+
+	tests := []struct {
+		name   string
+		step   ping.Step
+		vars   map[string]string
+		url    string
+		code   int
+		passed bool
+		err    string
+		want   map[string]string // the vars after the step
+	}{
+		{
+			name: "extracts the values",
+			step: ping.Step{Url: srv.URL + "/login", Contains: "token", Extract: []ping.Extract{
+				{Name: "token", From: "json", Key: "data.token"},
+				{Name: "id", From: "json", Key: "data.items.0.id"},
+				{Name: "header", From: "header", Key: "X-Token"},
+				{Name: "session", From: "cookie", Key: "session"},
+			}},
+			url: srv.URL + "/login", code: 200, passed: true,
+			want: map[string]string{"token": "a b/c&d", "id": "7", "header": "header-token", "session": "s3cr3t"},
+		},
+		{
+			name: "unexpected status",
+			step: ping.Step{Url: srv.URL + "/fail"},
+			url:  srv.URL + "/fail", code: 500, err: "expected status 200, got 500",
+		},
+		{
+			name: "expected failure",
+			step: ping.Step{Url: srv.URL + "/fail", Status: 500},
+			url:  srv.URL + "/fail", code: 500, passed: true,
+		},
+		{
+			name: "missing text",
+			step: ping.Step{Url: srv.URL + "/login", Contains: "welcome"},
+			url:  srv.URL + "/login", code: 200, err: `response doesn't contain "welcome"`,
+		},
+		{
+			name: "missing value",
+			step: ping.Step{Url: srv.URL + "/login", Extract: []ping.Extract{{Name: "x", From: "json", Key: "data.missing"}}},
+			url:  srv.URL + "/login", code: 200, err: `cannot extract "x": key missing not found`,
+		},
+		{
+			name: "redirect is not followed",
+			step: ping.Step{Url: srv.URL + "/redirect", Status: 302, Extract: []ping.Extract{{Name: "next", From: "header", Key: "Location"}}},
+			url:  srv.URL + "/redirect", code: 302, passed: true,
+			want: map[string]string{"next": "/login"},
+		},
+		{
+			name: "placeholders escaped in the url only",
+			step: ping.Step{Method: "POST", Url: srv.URL + "/echo?q={{token}}", Headers: map[string]string{"X-Q": "{{token}}"}, Body: "{{token}}", Contains: "q=a b/c&d header=a b/c&d body=a b/c&d"},
+			vars: map[string]string{"token": "a b/c&d"},
+			url:  srv.URL + "/echo?q=a%20b%2Fc%26d", code: 200, passed: true,
+			want: map[string]string{"token": "a b/c&d"},
+		},
+		{
+			name: "bad url",
+			step: ping.Step{Url: "://nowhere"},
+			url:  "://nowhere", err: `parse "://nowhere": missing protocol scheme`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := scenarioClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			vars := map[string]string{}
+			for k, v := range tt.vars {
+				vars[k] = v
+			}
+
+			sr, _ := runStep(context.Background(), client, tt.step, vars)
+
+			if sr.Url != tt.url {
+				t.Errorf("runStep() url = %s, want %s", sr.Url, tt.url)
+			}
+			if sr.Code != tt.code || sr.Passed != tt.passed || sr.Error != tt.err {
+				t.Errorf("runStep() = %d, %v, %q, want %d, %v, %q", sr.Code, sr.Passed, sr.Error, tt.code, tt.passed, tt.err)
+			}
+			for k, v := range tt.want {
+				if vars[k] != v {
+					t.Errorf("runStep() %s = %q, want %q", k, vars[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestScenarioTestStopsOnFailure(t *testing.T) {
+	srv := scenarioServer(t)
+
+	page := &ping.Page{Url: srv.URL, Steps: []ping.Step{
+		{Url: srv.URL + "/login", Extract: []ping.Extract{{Name: "token", From: "json", Key: "data.token"}}},
+		{Url: srv.URL + "/echo?q={{token}}", Contains: "nope"},
+		{Url: srv.URL + "/fail"},
+	}}
+
+	res, err := scenarioTest(context.Background(), page)
+	if err != nil {
+		t.Fatalf("scenarioTest() error = %v", err)
+	}
+	// the server answered fine, the assertion failed
+	if res.Code != codeAssertionFailed || len(res.Steps) != 2 {
+		t.Errorf("scenarioTest() = %d after %d steps, want %d after 2", res.Code, len(res.Steps), codeAssertionFailed)
+	}
+}
+
+func TestJsonPath(t *testing.T) {
+	body := []byte(`{"data":{"token":"abc","count":12,"ratio":0.5,"ok":true,"none":null,"items":[{"id":"x"},{"id":"y"}],"obj":{"a":1}}}`)
+
+	tests := []struct {
+		path string
+		want string
+		err  bool
+	}{
+		{"data.token", "abc", false},
+		{"data.count", "12", false},
+		{"data.ratio", "0.5", false},
+		{"data.ok", "true", false},
+		{"data.items.1.id", "y", false},
+		{"data.obj", `{"a":1}`, false},
+		{"data.none", "", true},
+		{"data.missing", "", true},
+		{"data.items.2.id", "", true},
+		{"data.items.first", "", true},
+		{"data.token.deeper", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := jsonPath(body, tt.path)
+			if (err != nil) != tt.err || got != tt.want {
+				t.Errorf("jsonPath() = %q, %v, want %q (error %v)", got, err, tt.want, tt.err)
+			}
+		})
+	}
+
+	if _, err := jsonPath([]byte("<html>"), "data"); err == nil {
+		t.Error("jsonPath() of not json, want an error")
+	}
+}
+
+func TestExtract(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"X-Token": {"t1"}, "Set-Cookie": {"session=s1; Path=/"}}}
+	body := []byte(`{"token":"j1"}`)
+
+	tests := []struct {
+		name string
+		e    ping.Extract
+		want string
+		err  bool
+	}{
+		{"header", ping.Extract{From: "header", Key: "X-Token"}, "t1", false},
+		{"header any case", ping.Extract{From: "header", Key: "x-token"}, "t1", false},
+		{"missing header", ping.Extract{From: "header", Key: "X-Other"}, "", true},
+		{"cookie", ping.Extract{From: "cookie", Key: "session"}, "s1", false},
+		{"missing cookie", ping.Extract{From: "cookie", Key: "other"}, "", true},
+		{"json", ping.Extract{From: "json", Key: "token"}, "j1", false},
+		{"unknown source", ping.Extract{From: "body", Key: "token"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extract(tt.e, resp, body)
+			if (err != nil) != tt.err || got != tt.want {
+				t.Errorf("extract() = %q, %v, want %q (error %v)", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	vars := map[string]string{"id": "7", "q": "a b/c&d=e+f"}
+
+	tests := []struct {
+		name   string
+		in     string
+		escape func(string) string
+		want   string
+	}{
+		{"none", "/items", nil, "/items"},
+		{"raw", "{{id}}: {{q}}", nil, "7: a b/c&d=e+f"},
+		{"escaped", "/items/{{id}}?q={{q}}", urlEscape, "/items/7?q=a%20b%2Fc%26d%3De%2Bf"},
+		{"unknown stays", "{{other}}", urlEscape, "{{other}}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := placeholders(vars, tt.escape).Replace(tt.in); got != tt.want {
+				t.Errorf("placeholders() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tomekwlod/ping"
+)
+
+// the statuspage indicators ordered by their severity
+var indicators = map[string]int{
+	"none":        0,
+	"maintenance": 0, // planned, not an outage
+	"minor":       1,
+	"major":       2,
+	"critical":    3,
+}
+
+// instatus reports the page status instead of the indicator
+var instatusIndicators = map[string]string{
+	"UP":                "none",
+	"UNDERMAINTENANCE":  "maintenance",
+	"HASISSUES":         "major",
+	"HASMAJORISSUES":    "critical",
+	"HASMINORISSUES":    "minor",
+	"UNDER_MAINTENANCE": "maintenance",
+}
+
+// statusPageTest checks a third-party status page. Such pages return 200 even during the outages, so instead of the
+// code we read the reported indicator; the page is down (503) when the indicator reaches the configured level
+func statusPageTest(ctx context.Context, page *ping.Page) (fetchResult, error) {
+	cnf := page.StatusPage
+	if cnf == nil {
+		cnf = &ping.StatusPageCheck{}
+	}
+
+	res, err := urlTest(ctx, statusPageUrl(page.Url, cnf.Format))
+	if err != nil || res.Code != 200 {
+		// the status page itself is broken
+		return res, err
+	}
+
+	indicator, description, err := parseStatusPage(cnf.Format, []byte(res.Content))
+	if err != nil {
+		res.Code = codeAssertionFailed
+		res.Content = err.Error() + "\n\n" + res.Content
+
+		return res, nil
+	}
+
+	downAt := cnf.DownAt
+	if downAt == "" {
+		downAt = "major"
+	}
+
+	res.Content = indicator + ": " + description
+	if indicators[indicator] >= indicators[downAt] {
+		res.Code = 503
+	}
+
+	return res, nil
+}
+
+// statusPageUrl appends the api path when only the address of the status page is given
+func statusPageUrl(url, format string) string {
+	if strings.HasSuffix(url, ".json") {
+		return url
+	}
+
+	url = strings.TrimRight(url, "/")
+	if format == "instatus" {
+		return url + "/summary.json"
+	}
+
+	return url + "/api/v2/status.json"
+}
+
+func parseStatusPage(format string, body []byte) (indicator, description string, err error) {
+	switch format {
+	case "", "statuspage":
+		// {"page":{...},"status":{"indicator":"minor","description":"Partially Degraded Service"}}
+		var doc struct {
+			Status struct {
+				Indicator   string `json:"indicator"`
+				Description string `json:"description"`
+			} `json:"status"`
+		}
+		if err = json.Unmarshal(body, &doc); err != nil {
+			return
+		}
+
+		indicator, description = doc.Status.Indicator, doc.Status.Description
+	case "instatus":
+		// {"page":{"name":"...","url":"...","status":"HASISSUES"}}
+		var doc struct {
+			Page struct {
+				Status string `json:"status"`
+			} `json:"page"`
+		}
+		if err = json.Unmarshal(body, &doc); err != nil {
+			return
+		}
+
+		indicator, description = instatusIndicators[doc.Page.Status], doc.Page.Status
+	default:
+		return "", "", fmt.Errorf("unknown status page format %q", format)
+	}
+
+	if _, ok := indicators[indicator]; !ok {
+		return "", "", fmt.Errorf("unknown status page indicator %q", indicator)
+	}
+
+	return
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tomekwlod/ping"
+)
+
+// statusPageServer serves the body at the api path of the format, like the provider does
+func statusPageServer(t *testing.T, path, body string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func statuspageBody(indicator string) string {
+	return `{"page":{"id":"x","name":"Provider"},"status":{"indicator":"` + indicator + `","description":"Some status"}}`
+}
+
+func instatusBody(status string) string {
+	return `{"page":{"name":"Provider","url":"https://status.example.com","status":"` + status + `"}}`
+}
+
+func TestStatusPageTest(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		body   string
+		downAt string
+		code   int
+	}{
+		{"statuspage none", "statuspage", statuspageBody("none"), "", 200},
+		{"statuspage maintenance", "statuspage", statuspageBody("maintenance"), "minor", 200},
+		{"statuspage minor below major", "statuspage", statuspageBody("minor"), "", 200},
+		{"statuspage minor at minor", "statuspage", statuspageBody("minor"), "minor", 503},
+		{"statuspage major at major", "", statuspageBody("major"), "major", 503},
+		{"statuspage major below critical", "statuspage", statuspageBody("major"), "critical", 200},
+		{"statuspage critical", "statuspage", statuspageBody("critical"), "critical", 503},
+		{"statuspage unknown indicator", "statuspage", statuspageBody("weird"), "", codeAssertionFailed},
+		{"statuspage not json", "statuspage", `<html></html>`, "", codeAssertionFailed},
+
+		{"instatus up", "instatus", instatusBody("UP"), "minor", 200},
+		{"instatus maintenance", "instatus", instatusBody("UNDERMAINTENANCE"), "minor", 200},
+		{"instatus minor below major", "instatus", instatusBody("HASMINORISSUES"), "", 200},
+		{"instatus minor at minor", "instatus", instatusBody("HASMINORISSUES"), "minor", 503},
+		{"instatus issues at major", "instatus", instatusBody("HASISSUES"), "major", 503},
+		{"instatus issues below critical", "instatus", instatusBody("HASISSUES"), "critical", 200},
+		{"instatus major issues", "instatus", instatusBody("HASMAJORISSUES"), "critical", 503},
+		{"instatus unknown status", "instatus", instatusBody("WEIRD"), "", codeAssertionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/api/v2/status.json"
+			if tt.format == "instatus" {
+				path = "/summary.json"
+			}
+			srv := statusPageServer(t, path, tt.body)
+
+			page := &ping.Page{Url: srv.URL, Type: ping.CheckStatusPage, StatusPage: &ping.StatusPageCheck{Format: tt.format, DownAt: tt.downAt}}
+
+			res, err := statusPageTest(context.Background(), page)
+			if err != nil {
+				t.Fatalf("statusPageTest() error = %v", err)
+			}
+			if res.Code != tt.code {
+				t.Errorf("statusPageTest() code = %d (%s), want %d", res.Code, res.Content, tt.code)
+			}
+		})
+	}
+}
+
+func TestStatusPageTestBrokenPage(t *testing.T) {
+	// the status page itself answers with an error, its code is the result
+	srv := statusPageServer(t, "/somewhere/else", "")
+
+	page := &ping.Page{Url: srv.URL, Type: ping.CheckStatusPage, StatusPage: &ping.StatusPageCheck{}}
+
+	res, err := statusPageTest(context.Background(), page)
+	if err != nil {
+		t.Fatalf("statusPageTest() error = %v", err)
+	}
+	if res.Code != 404 {
+		t.Errorf("statusPageTest() code = %d, want 404", res.Code)
+	}
+}
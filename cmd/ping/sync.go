@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tomekwlod/ping"
+	"github.com/tomekwlod/ping/db"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// runSync is the `ping sync -f monitors.yml` subcommand. It makes the pages match the monitors from the file
+// (the same format as the GET /export of the server): prints the plan and applies it
+func runSync(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	file := fs.String("f", "monitors.yml", "YAML or JSON file with the monitors")
+	prune := fs.Bool("prune", false, "delete the pages which are not in the file")
+	dryRun := fs.Bool("dry-run", false, "print the plan only")
+	project := fs.String("project", "", "id of the project to sync; the pages of the other projects are left alone")
+	fs.Parse(args)
+
+	data, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+
+	monitors, err := ping.ParseMonitors(data)
+	if err != nil {
+		return err
+	}
+
+	mgoSession, err := db.CreateSession(mgoHost())
+	if err != nil {
+		return fmt.Errorf("Cannot connect to Mongodb: %v", err)
+	}
+	defer mgoSession.Close()
+
+	s := &service{session: mgoSession}
+
+	var projects []bson.ObjectId
+	if *project != "" {
+		if !bson.IsObjectIdHex(*project) {
+			return fmt.Errorf("Invalid project id %s", *project)
+		}
+		projects = []bson.ObjectId{bson.ObjectIdHex(*project)}
+
+		for i := range monitors {
+			if monitors[i].Project == "" {
+				monitors[i].Project = projects[0]
+			}
+		}
+	}
+
+	return syncMonitors(s, monitors, projects, *prune, *dryRun)
+}
+
+// syncMonitors plans and (unless dryRun) applies the monitors to the pages of the projects (nil means all of them)
+func syncMonitors(s *service, monitors []ping.Monitor, projects []bson.ObjectId, prune, dryRun bool) error {
+	repo := &ping.PageRepository{Session: s.session.Clone(), Projects: projects}
+	defer repo.Close()
+
+	pages, _, err := repo.Pages(ping.PageFilter{})
+	if err != nil {
+		return err
+	}
+
+	plan, err := ping.NewPlan(pages, monitors, prune, projects)
+	if err != nil {
+		return err
+	}
+
+	printPlan(os.Stdout, plan)
+
+	if dryRun || plan.Empty() {
+		return nil
+	}
+
+	// the server may have never run against this db
+	if err := repo.EnsureIndexes(); err != nil {
+		return err
+	}
+
+	auditRepo := &ping.AuditRepository{Session: s.session.Clone()}
+	defer auditRepo.Close()
+
+	actor := "cli"
+	if u := os.Getenv("USER"); u != "" {
+		actor = "cli:" + u
+	}
+
+	err = plan.Apply(repo, actor, func(action string, before, after *ping.Page) {
+		entry, err := ping.PageAudit(actor, action, before, after)
+		if err == nil {
+			err = auditRepo.Log(entry)
+		}
+		if err != nil {
+			log.Println("Cannot write the audit: ", err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Applied.")
+
+	return nil
+}
+
+func printPlan(w io.Writer, plan *ping.Plan) {
+	for _, m := range plan.Create {
+		fmt.Fprintf(w, "+ %s (%s)\n", m.Name, m.Url)
+	}
+
+	for _, u := range plan.Update {
+		fields := []string{}
+		for f := range u.Changes {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+
+		fmt.Fprintf(w, "~ %s (%s): %s\n", u.Monitor.Name, u.Monitor.Url, strings.Join(fields, ", "))
+	}
+
+	for _, d := range plan.Delete {
+		fmt.Fprintf(w, "- %s (%s)\n", d.Name, d.Url)
+	}
+
+	fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d to delete.\n", len(plan.Create), len(plan.Update), len(plan.Delete))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tomekwlod/ping"
+)
+
+// tracer collects the moments of the request phases reported by the httptrace hooks. The hooks may run
+// concurrently (eg. the connects of Happy Eyeballs) and even after the request is done, so the moments are
+// guarded and only the first one of every phase is kept
+type tracer struct {
+	mu sync.Mutex
+
+	start, dnsStart, dnsDone, connectStart, connectDone, tlsStart, tlsDone, firstByte time.Time
+
+	tlsExpiry *time.Time // when the certificate of the server expires
+}
+
+func (t *tracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone) },
+		ConnectStart:         func(string, string) { t.mark(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { t.mark(&t.connectDone) },
+		TLSHandshakeStart:    func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone:     t.tlsHandshakeDone,
+		GotFirstResponseByte: func() { t.mark(&t.firstByte) },
+	}
+}
+
+// mark sets the moment of the phase to now, unless it's already set
+func (t *tracer) mark(moment *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if moment.IsZero() {
+		*moment = time.Now()
+	}
+}
+
+func (t *tracer) tlsHandshakeDone(state tls.ConnectionState, err error) {
+	t.mark(&t.tlsDone)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err == nil && len(state.PeerCertificates) > 0 && t.tlsExpiry == nil {
+		expiry := state.PeerCertificates[0].NotAfter
+		t.tlsExpiry = &expiry
+	}
+}
+
+// timing turns the collected moments into the phase durations; end is the moment the body was read
+func (t *tracer) timing(end time.Time) *ping.Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return &ping.Timing{
+		DNS:      seconds(t.dnsStart, t.dnsDone),
+		Connect:  seconds(t.connectStart, t.connectDone),
+		TLS:      seconds(t.tlsStart, t.tlsDone),
+		TTFB:     seconds(t.start, t.firstByte),
+		Transfer: seconds(t.firstByte, end),
+	}
+}
+
+// expiry is when the certificate of the server expires, nil if there was no tls
+func (t *tracer) expiry() *time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.tlsExpiry
+}
+
+// addTiming adds the phases of t to the sum, which is made on the first call
+func addTiming(sum, t *ping.Timing) *ping.Timing {
+	if t == nil {
+		return sum
+	}
+	if sum == nil {
+		sum = &ping.Timing{}
+	}
+
+	sum.DNS += t.DNS
+	sum.Connect += t.Connect
+	sum.TLS += t.TLS
+	sum.TTFB += t.TTFB
+	sum.Transfer += t.Transfer
+
+	return sum
+}
+
+// seconds between the two moments, 0 if the phase didn't happen (eg. a reused connection has no dns/connect)
+func seconds(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+
+	return to.Sub(from).Seconds()
+}
+
+// assertLatency turns the successful result into a failed one when any of the phases is too slow
+func assertLatency(assertions []ping.LatencyAssertion, res *fetchResult) {
+	failed := []string{}
+
+	for _, a := range assertions {
+		took, ok := res.Duration.Seconds(), a.Phase == "total"
+		if !ok && res.Timing != nil {
+			took, ok = res.Timing.Phase(a.Phase)
+		}
+		if !ok {
+			// no timing; the grpc checks can have only the total (see the Validate)
+			continue
+		}
+
+		if took > a.Max {
+			failed = append(failed, fmt.Sprintf("%s took %.3fs, max is %.3fs", a.Phase, took, a.Max))
+		}
+	}
+
+	if len(failed) > 0 {
+		res.Code = codeAssertionFailed
+		res.Content = strings.Join(failed, "\n")
+	}
+}
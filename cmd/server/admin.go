@@ -0,0 +1,407 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/context"
+	"github.com/julienschmidt/httprouter"
+	"github.com/tomekwlod/ping"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// the cookie with the session token of the admin ui. It's SameSite=Lax, so the browsers don't send it
+// with the cross-site form posts
+const sessionCookie = "ping_session"
+
+// uiAuthHandler is the authHandler of the admin ui: the session token is taken from the cookie and instead of
+// the json errors the user is sent to the login form
+func (s *service) uiAuthHandler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(sessionCookie)
+		if err != nil {
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+
+		p, err := s.authenticate(c.Value)
+		if errors.Is(err, ping.ErrNotFound) {
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			s.htmlFail(w, err)
+			return
+		}
+
+		if role, _ := context.Get(r, "role").(string); role != "" && !ping.RoleAllows(p.Role, role) {
+			http.Error(w, "Your role doesn't allow this action.", http.StatusForbidden)
+			return
+		}
+
+		context.Set(r, "principal", p)
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// htmlFail is the fail of the html pages (the admin ui, the status page), the error is sent as plain text
+func (s *service) htmlFail(w http.ResponseWriter, err error) {
+	e := s.errorFor(err)
+	http.Error(w, e.Detail, e.Status)
+}
+
+// adminData is passed to every admin template
+type adminData struct {
+	User    *principal
+	Message string
+	Error   string
+
+	Filter   ping.PageFilter
+	Pages    []*ping.Page
+	Page     *ping.Page
+	Projects []*ping.Project
+	Chart    *chart
+}
+
+// CanEdit tells if the user can modify the pages
+func (d adminData) CanEdit() bool {
+	return d.User != nil && ping.RoleAllows(d.User.Role, ping.RoleEditor)
+}
+
+func (s *service) renderAdmin(w http.ResponseWriter, r *http.Request, name string, data adminData) {
+	if p, ok := context.Get(r, "principal").(*principal); ok {
+		data.User = p
+	}
+	if data.Message == "" {
+		data.Message = r.URL.Query().Get("msg")
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		s.log.Error("cannot render the template", "error", err)
+	}
+}
+
+func (s *service) adminLoginFormHandler(w http.ResponseWriter, r *http.Request) {
+	s.renderAdmin(w, r, "admin_login.html", adminData{})
+}
+
+func (s *service) adminLoginHandler(w http.ResponseWriter, r *http.Request) {
+	repo := s.getUserRepo()
+	defer repo.Close()
+
+	token, _, err := repo.Login(r.PostFormValue("username"), r.PostFormValue("password"))
+	if err != nil && !errors.Is(err, ping.ErrInvalidLogin) {
+		s.htmlFail(w, err)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		s.renderAdmin(w, r, "admin_login.html", adminData{Error: "Invalid username or password."})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/admin",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (s *service) adminLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		repo := s.getUserRepo()
+		defer repo.Close()
+
+		if err = repo.Logout(c.Value); err != nil {
+			s.htmlFail(w, err)
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/admin", MaxAge: -1})
+	http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+}
+
+// adminPagesHandler lists the pages with the same filters as GET /pages
+func (s *service) adminPagesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := ping.PageFilter{
+		Group:  q.Get("group"),
+		Status: q.Get("status"),
+		Search: q.Get("q"),
+		Sort:   "name",
+	}
+	if t := q.Get("tag"); t != "" {
+		filter.Tags = []string{t}
+	}
+
+	repo := s.getPageRepo(r)
+	defer repo.Close()
+
+	pages, _, err := repo.Pages(filter)
+	if err != nil {
+		s.htmlFail(w, err)
+		return
+	}
+
+	s.renderAdmin(w, r, "admin_pages.html", adminData{Filter: filter, Pages: pages})
+}
+
+func (s *service) adminNewPageHandler(w http.ResponseWriter, r *http.Request) {
+	s.renderAdmin(w, r, "admin_page.html", adminData{Page: &ping.Page{Interval: 5}, Projects: s.adminProjects(r)})
+}
+
+func (s *service) adminCreatePageHandler(w http.ResponseWriter, r *http.Request) {
+	page := &ping.Page{}
+	if err := pageFromForm(r, page); err != nil {
+		s.renderAdmin(w, r, "admin_page.html", adminData{Page: page, Projects: s.adminProjects(r), Error: err.Error()})
+		return
+	}
+	page.SetInsertDefaults(time.Now())
+	page.CreatedBy = context.Get(r, "principal").(*principal).Name
+	page.ModifiedBy = page.CreatedBy
+	defaultProject(r, page)
+
+	repo := s.getPageRepo(r)
+	defer repo.Close()
+
+	if err := repo.Create(page); err != nil {
+		s.renderAdmin(w, r, "admin_page.html", adminData{Page: page, Projects: s.adminProjects(r), Error: err.Error()})
+		return
+	}
+
+	s.audit(r, ping.ActionCreate, nil, page)
+
+	http.Redirect(w, r, "/admin/page/"+page.Id.Hex()+"?msg=Page+created", http.StatusSeeOther)
+}
+
+// adminPageHandler shows the page: the edit form and the chart of the latest checks
+func (s *service) adminPageHandler(w http.ResponseWriter, r *http.Request) {
+	params := context.Get(r, "params").(httprouter.Params)
+
+	repo := s.getPageRepo(r)
+	defer repo.Close()
+
+	page, err := repo.Find(params.ByName("id"))
+	if err != nil {
+		s.htmlFail(w, err)
+		return
+	}
+
+	entryRepo := s.getPageEntryRepo()
+	defer entryRepo.Close()
+
+	entries, err := entryRepo.History(params.ByName("id"), 100)
+	if err != nil {
+		s.htmlFail(w, err)
+		return
+	}
+
+	s.renderAdmin(w, r, "admin_page.html", adminData{Page: &page.Data, Projects: s.adminProjects(r), Chart: historyChart(&page.Data, entries)})
+}
+
+func (s *service) adminUpdatePageHandler(w http.ResponseWriter, r *http.Request) {
+	params := context.Get(r, "params").(httprouter.Params)
+
+	repo := s.getPageRepo(r)
+	defer repo.Close()
+
+	before, err := repo.Find(params.ByName("id"))
+	if err != nil {
+		s.htmlFail(w, err)
+		return
+	}
+
+	// only the fields of the form are changed, the rest of the page (checks, assertions...) stays as it is
+	page := before.Data
+	if err = pageFromForm(r, &page); err != nil {
+		s.renderAdmin(w, r, "admin_page.html", adminData{Page: &page, Projects: s.adminProjects(r), Error: err.Error()})
+		return
+	}
+	page.SetUpdateDefaults(time.Now())
+	page.ModifiedBy = context.Get(r, "principal").(*principal).Name
+
+	if err = repo.Update(&page); err != nil {
+		s.renderAdmin(w, r, "admin_page.html", adminData{Page: &page, Projects: s.adminProjects(r), Error: err.Error()})
+		return
+	}
+
+	s.audit(r, ping.ActionUpdate, &before.Data, &page)
+
+	http.Redirect(w, r, "/admin/page/"+page.Id.Hex()+"?msg=Page+saved", http.StatusSeeOther)
+}
+
+// adminPausePageHandler pauses the page (or resumes the paused one)
+func (s *service) adminPausePageHandler(w http.ResponseWriter, r *http.Request) {
+	s.adminChangePage(w, r, func(p *ping.Page) string {
+		p.Disabled = !p.Disabled
+		if p.Disabled {
+			return "Page paused"
+		}
+
+		return "Page resumed"
+	})
+}
+
+// adminCheckPageHandler makes the page due, so it's checked by the next run of the checker (of every probe)
+// regardless of its interval
+func (s *service) adminCheckPageHandler(w http.ResponseWriter, r *http.Request) {
+	params := context.Get(r, "params").(httprouter.Params)
+
+	repo := s.getPageRepo(r)
+	defer repo.Close()
+
+	page, err := repo.Find(params.ByName("id"))
+	if err != nil {
+		s.htmlFail(w, err)
+		return
+	}
+
+	// the next ping is the state of the checker, not the definition, so it's not an Update
+	if err = repo.CheckNow(&page.Data, time.Now()); err != nil {
+		s.htmlFail(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/page/"+page.Data.Id.Hex()+"?msg=Check+queued+for+the+next+checker+run", http.StatusSeeOther)
+}
+
+func (s *service) adminChangePage(w http.ResponseWriter, r *http.Request, change func(*ping.Page) string) {
+	params := context.Get(r, "params").(httprouter.Params)
+
+	repo := s.getPageRepo(r)
+	defer repo.Close()
+
+	before, err := repo.Find(params.ByName("id"))
+	if err != nil {
+		s.htmlFail(w, err)
+		return
+	}
+
+	page := before.Data
+	msg := change(&page)
+	page.SetUpdateDefaults(time.Now())
+	page.ModifiedBy = context.Get(r, "principal").(*principal).Name
+
+	if err = repo.Update(&page); err != nil {
+		s.htmlFail(w, err)
+		return
+	}
+
+	s.audit(r, ping.ActionUpdate, &before.Data, &page)
+
+	http.Redirect(w, r, "/admin/page/"+page.Id.Hex()+"?msg="+strings.Replace(msg, " ", "+", -1), http.StatusSeeOther)
+}
+
+// adminProjects are the projects to choose from in the page form
+func (s *service) adminProjects(r *http.Request) []*ping.Project {
+	repo := s.getProjectRepo(r)
+	defer repo.Close()
+
+	// without the projects the form still works, the page stays in its project
+	projects, err := repo.Projects()
+	if err != nil {
+		s.log.Error("cannot list the projects", "error", err)
+	}
+
+	return projects
+}
+
+// pageFromForm sets the fields of the form on the page
+func pageFromForm(r *http.Request, p *ping.Page) error {
+	p.Name = strings.TrimSpace(r.PostFormValue("name"))
+	p.Url = strings.TrimSpace(r.PostFormValue("url"))
+	p.Description = strings.TrimSpace(r.PostFormValue("description"))
+	// an empty type is http as well, the explicit one is kept
+	if t := r.PostFormValue("type"); t != "" || p.Type != ping.CheckHTTP {
+		p.Type = t
+	}
+	p.Group = strings.TrimSpace(r.PostFormValue("group"))
+	p.Tags = splitList(r.PostFormValue("tags"))
+	p.Disabled = r.PostFormValue("disabled") == "on"
+
+	if project := r.PostFormValue("project"); bson.IsObjectIdHex(project) {
+		p.Project = bson.ObjectIdHex(project)
+	}
+
+	// the version the form was loaded with, so the changes made in the meantime are not overwritten
+	if v, err := strconv.Atoi(r.PostFormValue("version")); err == nil {
+		p.Version = v
+	}
+
+	interval, err := strconv.Atoi(r.PostFormValue("interval"))
+	if err != nil || interval < 1 {
+		return fmt.Errorf("Interval must be a number of minutes")
+	}
+	p.Interval = interval
+
+	if p.Url == "" {
+		return fmt.Errorf("Url is required")
+	}
+
+	return nil
+}
+
+// chart is the svg line of the check durations, the failed checks are marked with the dots
+type chart struct {
+	Width, Height int
+	Line          string
+	Failures      []chartPoint
+	Max           float64
+}
+
+type chartPoint struct {
+	X, Y float64
+	Code int
+	Time time.Time
+}
+
+// historyChart draws the entries (the newest first) of the page from the left (oldest) to the right
+func historyChart(page *ping.Page, entries []*ping.PageEntry) *chart {
+	c := &chart{Width: 800, Height: 160}
+	if len(entries) == 0 {
+		return c
+	}
+
+	for _, e := range entries {
+		if e.Load > c.Max {
+			c.Max = e.Load
+		}
+	}
+	if c.Max == 0 {
+		c.Max = 1
+	}
+
+	step := float64(c.Width)
+	if len(entries) > 1 {
+		step = float64(c.Width) / float64(len(entries)-1)
+	}
+
+	points := []string{}
+	for i := range entries {
+		e := entries[len(entries)-1-i]
+
+		x := float64(i) * step
+		y := float64(c.Height) - e.Load/c.Max*float64(c.Height-10)
+
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		if !page.Up(e.Code) {
+			c.Failures = append(c.Failures, chartPoint{X: x, Y: y, Code: e.Code, Time: e.Created})
+		}
+	}
+	c.Line = strings.Join(points, " ")
+
+	return c
+}
@@ -1,22 +1,50 @@
 package main
 
 import (
+	stdcontext "context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log/slog"
 	"net/http"
+	"os"
 	"reflect"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/context"
 	"github.com/julienschmidt/httprouter"
 	"github.com/tomekwlod/ping"
+	"github.com/tomekwlod/ping/notify"
+	"github.com/tomekwlod/ping/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/mgo.v2/bson"
+	"sigs.k8s.io/yaml"
 )
 
 var (
-	errBadRequest           = &Error{"bad_request", 400, "Bad request", "Request body is not well-formed. It must be JSON."}
-	errNotAcceptable        = &Error{"not_acceptable", 406, "Not Acceptable", "Accept header must be set to 'application/json'."}
-	errUnsupportedMediaType = &Error{"unsupported_media_type", 415, "Unsupported Media Type", "Content-Type header must be set to: 'application/json'."}
-	errInternalServer       = &Error{"internal_server_error", 500, "Internal Server Error", "Something went wrong."}
+	errBadRequest           = &Error{"bad_request", 400, "Bad request", "Request body is not well-formed. It must be JSON.", nil}
+	errUnauthorized         = &Error{"unauthorized", 401, "Unauthorized", "A valid API key or session token must be passed in the 'Authorization: Bearer <token>' header.", nil}
+	errInvalidLogin         = &Error{"invalid_login", 401, "Unauthorized", "Invalid username or password.", nil}
+	errForbidden            = &Error{"forbidden", 403, "Forbidden", "Your role doesn't allow this action.", nil}
+	errNotAcceptable        = &Error{"not_acceptable", 406, "Not Acceptable", "Accept header must be set to 'application/json'.", nil}
+	errUnsupportedMediaType = &Error{"unsupported_media_type", 415, "Unsupported Media Type", "Content-Type header must be set to: 'application/json'.", nil}
+	errInternalServer       = &Error{"internal_server_error", 500, "Internal Server Error", "Something went wrong.", nil}
+)
+
+// the errors of the repositories; their detail is the message of the repository error
+var (
+	errNotFound      = Error{"not_found", 404, "Not Found", "", nil}
+	errConflict      = Error{"conflict", 409, "Conflict", "", nil}
+	errUnprocessable = Error{"unprocessable_entity", 422, "Unprocessable Entity", "", nil}
+	errStale         = Error{"precondition_failed", 412, "Precondition Failed", "", nil}
 )
 
 // Errors
@@ -24,32 +52,94 @@ type Errors struct {
 	Errors []*Error `json:"errors"`
 }
 type Error struct {
-	Id     string `json:"id"`
-	Status int    `json:"status"`
-	Title  string `json:"title"`
-	Detail string `json:"detail"`
+	Id     string       `json:"id"`
+	Status int          `json:"status"`
+	Title  string       `json:"title"`
+	Detail string       `json:"detail"`
+	Source *ErrorSource `json:"source,omitempty"`
+}
+
+// ErrorSource points to the invalid part of the request: the field of the body (a JSON pointer, eg. "/data/url")
+// or the parameter of the url
+type ErrorSource struct {
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+}
+
+// badParam is the error of the invalid query parameter
+func badParam(param, detail string) *Error {
+	return &Error{"invalid_parameter", 400, "Bad request", detail, &ErrorSource{Parameter: param}}
 }
 
 func WriteError(w http.ResponseWriter, err *Error) {
+	WriteErrors(w, err.Status, []*Error{err})
+}
+
+func WriteErrors(w http.ResponseWriter, status int, errs []*Error) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(err.Status)
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(Errors{errs})
+}
+
+// fail answers with the Error matching the repository error (see errorFor); the invalid input
+// gets one Error per invalid field
+func (s *service) fail(w http.ResponseWriter, err error) {
+	var ve *ping.ValidationError
+	if errors.As(err, &ve) {
+		errs := []*Error{}
+		for _, f := range ve.Fields {
+			errs = append(errs, &Error{"invalid_field", 422, "Unprocessable Entity", f.Msg, &ErrorSource{Pointer: "/data/" + f.Field}})
+		}
+
+		WriteErrors(w, 422, errs)
+		return
+	}
 
-	json.NewEncoder(w).Encode(Errors{[]*Error{err}})
+	WriteError(w, s.errorFor(err))
 }
 
-func wrapHandler(h http.Handler) httprouter.Handle {
+// errorFor maps the kind of the repository error to the Error of the response. The storage failures
+// and anything unexpected are logged, the caller gets only the generic 500
+func (s *service) errorFor(err error) *Error {
+	var e Error
+	switch {
+	case errors.Is(err, ping.ErrNotFound):
+		e = errNotFound
+	case errors.Is(err, ping.ErrDuplicate):
+		e = errConflict
+	case errors.Is(err, ping.ErrValidation):
+		e = errUnprocessable
+	case errors.Is(err, ping.ErrStale):
+		e = errStale
+	default:
+		s.log.Error("request failed", "error", err)
+		return errInternalServer
+	}
+
+	var re *ping.Error
+	if errors.As(err, &re) {
+		e.Detail = re.Msg
+	}
+
+	return &e
+}
+
+func wrapHandler(h http.Handler, route, role string) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		context.Set(r, "params", ps)
+		context.Set(r, "route", route)
+		context.Set(r, "role", role)
 		h.ServeHTTP(w, r)
 	}
 }
 
 // Middlewares
-func recoverHandler(next http.Handler) http.Handler {
+func (s *service) recoverHandler(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				// s.logger.Printf("panic: %+v", err)
+				s.log.ErrorContext(r.Context(), "panic", "error", err, "method", r.Method, "url", r.URL.String(), "stack", string(debug.Stack()))
 				WriteError(w, errInternalServer)
 				return
 			}
@@ -61,19 +151,151 @@ func recoverHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// loggingHandler logs every request and wraps it in a span named after its route. The span continues the trace
+// of the caller (the traceparent header) and is passed on in the context of the request
 func (s *service) loggingHandler(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
+		route, _ := context.Get(r, "route").(string)
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := telemetry.Tracer().Start(ctx, r.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		r = withContext(r, ctx)
+		defer context.Clear(r)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
 		t1 := time.Now()
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(rec, r)
 		t2 := time.Now()
 
-		s.logger.Printf("[%s] %q %v\n", r.Method, r.URL.String(), t2.Sub(t1))
-		// log.Printf("[%s] %q %v\n", r.Method, r.URL.String(), t2.Sub(t1))
+		span.SetAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", route),
+			attribute.String("url.path", r.URL.Path),
+			attribute.Int("http.response.status_code", rec.status),
+		)
+
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+
+		s.log.Log(r.Context(), level, "request",
+			"method", r.Method,
+			"url", r.URL.String(),
+			"route", route,
+			"code", rec.status,
+			"duration", t2.Sub(t1).Seconds(),
+		)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// withContext is the r.WithContext which keeps the values of the gorilla context; they are stored by the request,
+// so the copy of the request would have none of them
+func withContext(r *http.Request, ctx stdcontext.Context) *http.Request {
+	rc := r.WithContext(ctx)
+	for k, v := range context.GetAll(r) {
+		context.Set(rc, k, v)
+	}
+
+	return rc
+}
+
+// statusRecorder remembers the status code written by the handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// principal is the one who makes the request: a logged in user or an API key
+type principal struct {
+	Name     string
+	Role     string
+	Projects []bson.ObjectId // nil means all the projects
+}
+
+// authHandler lets in only the requests with a valid API key or a user session token, passed in the
+// 'Authorization: Bearer <token>' (or 'X-API-Key') header, and with the role required by the route.
+// The PING_API_KEY env key (if set) is a master key with the admin role
+func (s *service) authHandler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			WriteError(w, errUnauthorized)
+			return
+		}
+
+		// only the unknown (or expired, revoked) token is unauthorized, the storage failure is ours
+		p, err := s.authenticate(token)
+		if errors.Is(err, ping.ErrNotFound) {
+			WriteError(w, errUnauthorized)
+			return
+		}
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+
+		if role, _ := context.Get(r, "role").(string); role != "" && !ping.RoleAllows(p.Role, role) {
+			WriteError(w, errForbidden)
+			return
+		}
+
+		context.Set(r, "principal", p)
+		next.ServeHTTP(w, r)
 	}
 
 	return http.HandlerFunc(fn)
 }
 
+func bearerToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+
+	return r.Header.Get("X-API-Key")
+}
+
+// authenticate finds who the token belongs to: the master key, an API key or a user session. The unknown token
+// is an ErrNotFound
+func (s *service) authenticate(token string) (*principal, error) {
+	if master := os.Getenv("PING_API_KEY"); master != "" && subtle.ConstantTimeCompare([]byte(token), []byte(master)) == 1 {
+		return &principal{Name: "master", Role: ping.RoleAdmin, Projects: nil}, nil
+	}
+
+	if ping.IsAPIKey(token) {
+		repo := s.getAPIKeyRepo()
+		defer repo.Close()
+
+		key, err := repo.FindByToken(token)
+		if err != nil {
+			return nil, err
+		}
+
+		return &principal{Name: "apikey:" + key.Name, Role: key.Role(), Projects: key.AllowedProjects()}, nil
+	}
+
+	repo := s.getUserRepo()
+	defer repo.Close()
+
+	user, err := repo.FindByToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &principal{Name: user.Username, Role: user.Role, Projects: user.AllowedProjects()}, nil
+}
+
 // Here is my request and I would like (to Accept) this response format
 // I expect to receive this format only
 func acceptHandler(next http.Handler) http.Handler {
@@ -89,6 +311,21 @@ func acceptHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// idHandler rejects the malformed :id of the url, so it never gets to the db
+func idHandler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		params, _ := context.Get(r, "params").(httprouter.Params)
+		if id := params.ByName("id"); id != "" && !bson.IsObjectIdHex(id) {
+			WriteError(w, badParam("id", "Id must be a 24 characters long hex ObjectId."))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
 // Content-Type header tells the server what the attached data actually is
 // Only for PUT & POST
 func contentTypeHandler(next http.Handler) http.Handler {
@@ -113,6 +350,12 @@ func bodyHandler(v interface{}) func(http.Handler) http.Handler {
 
 			err := json.NewDecoder(r.Body).Decode(val)
 
+			// the value of the wrong type is reported with its field
+			var te *json.UnmarshalTypeError
+			if errors.As(err, &te) && te.Field != "" {
+				WriteError(w, &Error{"invalid_field", 400, "Bad request", "Field " + te.Field + " must be " + te.Type.String() + ", not " + te.Value + ".", &ErrorSource{Pointer: "/" + strings.Replace(te.Field, ".", "/", -1)}})
+				return
+			}
 			if err != nil {
 				WriteError(w, errBadRequest)
 				return
@@ -134,24 +377,83 @@ func bodyHandler(v interface{}) func(http.Handler) http.Handler {
 func allowCorsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+		w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization, X-API-Key, If-Match")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT, PATCH")
 
 		w.WriteHeader(200)
 	}
 }
 
 // Main handlers
+
+// the pages listed at once: by default and at most
+const (
+	defaultPages = 100
+	maxPages     = 1000
+)
+
+// pagesHandler lists the pages; filters: ?tag=a&tag=b (all must match), ?group=, ?status=up|down|paused, ?q=text,
+// pagination: ?limit= (100 by default, 1000 at most) and ?offset=, ?sort=name|status|checked|created (-name for
+// descending) and ?fields=name,url,...
 func (s *service) pagesHandler(w http.ResponseWriter, r *http.Request) {
-	repo := s.getPageRepo()
+	repo := s.getPageRepo(r)
 	defer repo.Close()
 
-	pages, err := repo.Pages()
+	q := r.URL.Query()
+	filter := ping.PageFilter{
+		Tags:   q["tag"],
+		Group:  q.Get("group"),
+		Status: q.Get("status"),
+		Search: q.Get("q"),
+		Sort:   q.Get("sort"),
+		Limit:  defaultPages,
+	}
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxPages {
+			WriteError(w, badParam("limit", "Limit must be a number between 1 and "+strconv.Itoa(maxPages)+"."))
+			return
+		}
+		filter.Limit = n
+	}
+	if o := q.Get("offset"); o != "" {
+		n, err := strconv.Atoi(o)
+		if err != nil || n < 0 {
+			WriteError(w, badParam("offset", "Offset must be a number, 0 or more."))
+			return
+		}
+		filter.Offset = n
+	}
+	if !ping.ValidPageSort(filter.Sort) {
+		WriteError(w, badParam("sort", "Sort must be name, status, checked or created, with - for descending."))
+		return
+	}
+	if f := q.Get("fields"); f != "" {
+		filter.Fields = strings.Split(f, ",")
+	}
+	for _, f := range filter.Fields {
+		if !ping.ValidPageField(f) {
+			WriteError(w, badParam("fields", "Field "+f+" is unknown."))
+			return
+		}
+	}
+
+	pages, total, err := repo.Pages(filter)
 	if err != nil {
-		WriteError(w, errBadRequest)
+		s.fail(w, err)
 		return
 	}
 
+	// only the asked fields are returned
+	var data interface{} = pages
+	if len(filter.Fields) > 0 {
+		data, err = sparse(pages, filter.Fields)
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+	}
+
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
@@ -160,42 +462,128 @@ func (s *service) pagesHandler(w http.ResponseWriter, r *http.Request) {
 	// should be json.NewEncoder(w).Encode(pages) where pages are PageCollection
 	// below is a workaround to support data:{} responses
 	type resp struct {
-		Data []*ping.Page `json:"data"`
+		Data   interface{} `json:"data"`
+		Total  int         `json:"total"`
+		Limit  int         `json:"limit"`
+		Offset int         `json:"offset"`
+	}
+	json.NewEncoder(w).Encode(resp{Data: data, Total: total, Limit: filter.Limit, Offset: filter.Offset})
+}
+
+// sparse keeps only the given (json) fields of the pages, and the _id
+func sparse(pages []*ping.Page, fields []string) ([]map[string]interface{}, error) {
+	result := []map[string]interface{}{}
+
+	for _, p := range pages {
+		b, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+
+		all := map[string]interface{}{}
+		if err = json.Unmarshal(b, &all); err != nil {
+			return nil, err
+		}
+
+		m := map[string]interface{}{"_id": all["_id"]}
+		for _, f := range fields {
+			if v, ok := all[f]; ok {
+				m[f] = v
+			}
+		}
+
+		result = append(result, m)
 	}
-	json.NewEncoder(w).Encode(resp{Data: pages})
+
+	return result, nil
 }
 
 func (s *service) pageHandler(w http.ResponseWriter, r *http.Request) {
 	params := context.Get(r, "params").(httprouter.Params)
 
-	repo := s.getPageRepo()
+	repo := s.getPageRepo(r)
 	defer repo.Close()
 
 	page, err := repo.Find(params.ByName("id"))
 	if err != nil {
-		s.logger.Panicln(err)
+		s.fail(w, err)
+		return
 	}
 
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(&page.Data))
 
 	json.NewEncoder(w).Encode(page)
 }
 
+// the most entries the history of the page returns at once
+const maxHistory = 1000
+
+// pageHistoryHandler returns the latest checks of the page (?limit=, 100 by default, 1000 at most) with their
+// timing breakdown
+func (s *service) pageHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	params := context.Get(r, "params").(httprouter.Params)
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	if limit > maxHistory {
+		limit = maxHistory
+	}
+
+	// the page has to be visible to the caller
+	pageRepo := s.getPageRepo(r)
+	defer pageRepo.Close()
+
+	_, err = pageRepo.Find(params.ByName("id"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	repo := s.getPageEntryRepo()
+	defer repo.Close()
+
+	entries, err := repo.History(params.ByName("id"), limit)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	type resp struct {
+		Data []*ping.PageEntry `json:"data"`
+	}
+	json.NewEncoder(w).Encode(resp{Data: entries})
+}
+
 func (s *service) createpageHandler(w http.ResponseWriter, r *http.Request) {
 	body := context.Get(r, "body").(*ping.SinglePage)
 	body.Data.SetInsertDefaults(time.Now())
+	body.Data.CreatedBy = context.Get(r, "principal").(*principal).Name
+	body.Data.ModifiedBy = body.Data.CreatedBy
+	defaultProject(r, &body.Data)
 
-	repo := s.getPageRepo()
+	repo := s.getPageRepo(r)
 	defer repo.Close()
 
 	err := repo.Create(&body.Data)
 	if err != nil {
-		s.logger.Panicln(err)
+		s.fail(w, err)
+		return
 	}
 
+	s.audit(r, ping.ActionCreate, nil, &body.Data)
+
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
@@ -205,50 +593,163 @@ func (s *service) createpageHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(body)
 }
 
+// defaultProject assigns the page to the project of the caller if the caller works with only one
+func defaultProject(r *http.Request, page *ping.Page) {
+	if p := projects(r); page.Project == "" && len(p) == 1 {
+		page.Project = p[0]
+	}
+}
+
 func (s *service) updatepageHandler(w http.ResponseWriter, r *http.Request) {
 	params := context.Get(r, "params").(httprouter.Params)
 	body := context.Get(r, "body").(*ping.SinglePage)
 
-	repo := s.getPageRepo()
+	repo := s.getPageRepo(r)
 	defer repo.Close()
 
-	update := ping.SinglePage{}
+	before, err := repo.Find(params.ByName("id"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	if !ifMatch(r, &before.Data) {
+		s.fail(w, ping.ErrPageChanged)
+		return
+	}
+
+	// only the definition is taken from the body, the rest of the page (the creation, the state of the checker,
+	// the last status) stays as it is
+	update := ping.SinglePage{Data: before.Data}
 	update.Data.Interval = body.Data.Interval
 	update.Data.Description = body.Data.Description
 	update.Data.Name = body.Data.Name
 	update.Data.Url = body.Data.Url
 	update.Data.RescueUrl = body.Data.RescueUrl
-	update.Data.LastStatus = body.Data.LastStatus
 	update.Data.DesiredStatus = body.Data.DesiredStatus
 	update.Data.Disabled = body.Data.Disabled
+	update.Data.Type = body.Data.Type
+	update.Data.GRPC = body.Data.GRPC
+	update.Data.Steps = body.Data.Steps
+	update.Data.ContentCheck = body.Data.ContentCheck
+	update.Data.StatusPage = body.Data.StatusPage
+	update.Data.Latency = body.Data.Latency
+	update.Data.Project = body.Data.Project
+	update.Data.ContactGroups = body.Data.ContactGroups
+	update.Data.Tags = body.Data.Tags
+	update.Data.Group = body.Data.Group
+	update.Data.Slug = body.Data.Slug
+	update.Data.Locations = body.Data.Locations
+	update.Data.Quorum = body.Data.Quorum
+	defaultProject(r, &update.Data)
 
-	update.Data.Id = bson.ObjectIdHex(params.ByName("id"))
 	update.Data.SetUpdateDefaults(time.Now())
+	update.Data.ModifiedBy = context.Get(r, "principal").(*principal).Name
 
-	err := repo.Update(&update.Data)
+	err = repo.Update(&update.Data)
 	if err != nil {
-		s.logger.Panicln(err)
+		s.fail(w, err)
+		return
 	}
 
+	s.audit(r, ping.ActionUpdate, &before.Data, &update.Data)
+
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+	w.Header().Set("ETag", etag(&update.Data))
 
 	w.WriteHeader(204)
 	w.Write([]byte("\n"))
 }
 
+// patchpageHandler changes only the fields present in the body, eg. {"data": {"disabled": true}}. With the If-Match
+// header (the ETag of GET /page/:id) the page is changed only if nobody changed it since it was read
+func (s *service) patchpageHandler(w http.ResponseWriter, r *http.Request) {
+	params := context.Get(r, "params").(httprouter.Params)
+	body := context.Get(r, "body").(*ping.SinglePagePatch)
+
+	repo := s.getPageRepo(r)
+	defer repo.Close()
+
+	before, err := repo.Find(params.ByName("id"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	if !ifMatch(r, &before.Data) {
+		s.fail(w, ping.ErrPageChanged)
+		return
+	}
+
+	page := before.Data
+	set, unset, err := page.ApplyPatch(body.Data)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	page.SetUpdateDefaults(time.Now())
+	page.ModifiedBy = context.Get(r, "principal").(*principal).Name
+
+	err = repo.Patch(&page, set, unset)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	s.audit(r, ping.ActionUpdate, &before.Data, &page)
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT, PATCH")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(&page))
+
+	json.NewEncoder(w).Encode(ping.SinglePage{Data: page})
+}
+
+// etag is the ETag of the page, its version
+func etag(p *ping.Page) string {
+	return `"` + strconv.Itoa(p.Version) + `"`
+}
+
+// ifMatch tells if the If-Match header (if any) matches the current version of the page
+func ifMatch(r *http.Request, p *ping.Page) bool {
+	h := r.Header.Get("If-Match")
+	if h == "" || h == "*" {
+		return true
+	}
+
+	for _, t := range strings.Split(h, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(t), "W/") == etag(p) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (s *service) deletepageHandler(w http.ResponseWriter, r *http.Request) {
 	params := context.Get(r, "params").(httprouter.Params)
 
-	repo := s.getPageRepo()
+	repo := s.getPageRepo(r)
 	defer repo.Close()
 
-	err := repo.Delete(params.ByName("id"))
+	before, err := repo.Find(params.ByName("id"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	err = repo.Delete(params.ByName("id"))
 	if err != nil {
-		s.logger.Panicln(err)
+		s.fail(w, err)
+		return
 	}
 
+	s.audit(r, ping.ActionDelete, &before.Data, nil)
+
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
@@ -256,3 +757,638 @@ func (s *service) deletepageHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(204)
 	w.Write([]byte("\n"))
 }
+
+func (s *service) restorepageHandler(w http.ResponseWriter, r *http.Request) {
+	params := context.Get(r, "params").(httprouter.Params)
+
+	repo := s.getPageRepo(r)
+	defer repo.Close()
+
+	before, err := repo.Find(params.ByName("id"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	err = repo.Restore(params.ByName("id"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	after, err := repo.Find(params.ByName("id"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	s.audit(r, ping.ActionRestore, &before.Data, &after.Data)
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(after)
+}
+
+// audit records the change of the page made by the caller of the request. The change is already saved,
+// so the failed audit is only logged
+func (s *service) audit(r *http.Request, action string, before, after *ping.Page) {
+	entry, err := ping.PageAudit(context.Get(r, "principal").(*principal).Name, action, before, after)
+	if err == nil {
+		repo := s.getAuditRepo(r)
+		defer repo.Close()
+
+		err = repo.Log(entry)
+	}
+	if err != nil {
+		s.log.Error("cannot write the audit", "action", action, "error", err)
+	}
+}
+
+// auditHandler lists the latest configuration changes; filters: ?page=<id>, ?actor=<name>, ?limit= (100 by default)
+func (s *service) auditHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	repo := s.getAuditRepo(r)
+	defer repo.Close()
+
+	entries, err := repo.Entries(ping.AuditFilter{Target: q.Get("page"), Actor: q.Get("actor"), Limit: limit})
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	type resp struct {
+		Data []*ping.AuditEntry `json:"data"`
+	}
+	json.NewEncoder(w).Encode(resp{Data: entries})
+}
+
+func (s *service) apiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	repo := s.getAPIKeyRepo()
+	defer repo.Close()
+
+	keys, err := repo.Keys()
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	type resp struct {
+		Data []*ping.APIKey `json:"data"`
+	}
+	json.NewEncoder(w).Encode(resp{Data: keys})
+}
+
+// createAPIKeyHandler returns the token of the new key; it's not possible to read it again later
+func (s *service) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	body := context.Get(r, "body").(*ping.SingleAPIKey)
+	body.Data.SetInsertDefaults(time.Now())
+
+	repo := s.getAPIKeyRepo()
+	defer repo.Close()
+
+	token, err := repo.Create(&body.Data)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	type resp struct {
+		Data  ping.APIKey `json:"data"`
+		Token string      `json:"token"`
+	}
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(resp{Data: body.Data, Token: token})
+}
+
+func (s *service) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	params := context.Get(r, "params").(httprouter.Params)
+
+	repo := s.getAPIKeyRepo()
+	defer repo.Close()
+
+	err := repo.Revoke(params.ByName("id"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+
+	w.WriteHeader(204)
+	w.Write([]byte("\n"))
+}
+
+// loginHandler opens a new session for the user; the returned token is used as the Bearer token
+func (s *service) loginHandler(w http.ResponseWriter, r *http.Request) {
+	body := context.Get(r, "body").(*ping.SingleUser)
+
+	repo := s.getUserRepo()
+	defer repo.Close()
+
+	token, user, err := repo.Login(body.Data.Username, body.Data.PlainPassword)
+	if errors.Is(err, ping.ErrInvalidLogin) {
+		WriteError(w, errInvalidLogin)
+		return
+	}
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	type resp struct {
+		Data  *ping.User `json:"data"`
+		Token string     `json:"token"`
+	}
+	json.NewEncoder(w).Encode(resp{Data: user, Token: token})
+}
+
+func (s *service) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	repo := s.getUserRepo()
+	defer repo.Close()
+
+	err := repo.Logout(bearerToken(r))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+
+	w.WriteHeader(204)
+	w.Write([]byte("\n"))
+}
+
+func (s *service) usersHandler(w http.ResponseWriter, r *http.Request) {
+	repo := s.getUserRepo()
+	defer repo.Close()
+
+	users, err := repo.Users()
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	type resp struct {
+		Data []*ping.User `json:"data"`
+	}
+	json.NewEncoder(w).Encode(resp{Data: users})
+}
+
+func (s *service) createUserHandler(w http.ResponseWriter, r *http.Request) {
+	body := context.Get(r, "body").(*ping.SingleUser)
+	body.Data.SetInsertDefaults(time.Now())
+
+	repo := s.getUserRepo()
+	defer repo.Close()
+
+	err := repo.Create(&body.Data)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (s *service) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	params := context.Get(r, "params").(httprouter.Params)
+
+	repo := s.getUserRepo()
+	defer repo.Close()
+
+	err := repo.Delete(params.ByName("id"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+
+	w.WriteHeader(204)
+	w.Write([]byte("\n"))
+}
+
+func (s *service) projectsHandler(w http.ResponseWriter, r *http.Request) {
+	repo := s.getProjectRepo(r)
+	defer repo.Close()
+
+	projects, err := repo.Projects()
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	type resp struct {
+		Data []*ping.Project `json:"data"`
+	}
+	json.NewEncoder(w).Encode(resp{Data: projects})
+}
+
+func (s *service) createProjectHandler(w http.ResponseWriter, r *http.Request) {
+	body := context.Get(r, "body").(*ping.SingleProject)
+	body.Data.SetInsertDefaults(time.Now())
+
+	repo := s.getProjectRepo(r)
+	defer repo.Close()
+
+	err := repo.Create(&body.Data)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (s *service) deleteProjectHandler(w http.ResponseWriter, r *http.Request) {
+	params := context.Get(r, "params").(httprouter.Params)
+
+	repo := s.getProjectRepo(r)
+	defer repo.Close()
+
+	err := repo.Delete(params.ByName("id"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+
+	w.WriteHeader(204)
+	w.Write([]byte("\n"))
+}
+
+func (s *service) contactGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	repo := s.getContactGroupRepo(r)
+	defer repo.Close()
+
+	groups, err := repo.Groups()
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	type resp struct {
+		Data []*ping.ContactGroup `json:"data"`
+	}
+	json.NewEncoder(w).Encode(resp{Data: groups})
+}
+
+func (s *service) createContactGroupHandler(w http.ResponseWriter, r *http.Request) {
+	body := context.Get(r, "body").(*ping.SingleContactGroup)
+	body.Data.SetInsertDefaults(time.Now())
+
+	if p := projects(r); body.Data.Project == "" && len(p) == 1 {
+		body.Data.Project = p[0]
+	}
+
+	repo := s.getContactGroupRepo(r)
+	defer repo.Close()
+
+	err := repo.Create(&body.Data)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (s *service) deleteContactGroupHandler(w http.ResponseWriter, r *http.Request) {
+	params := context.Get(r, "params").(httprouter.Params)
+
+	repo := s.getContactGroupRepo(r)
+	defer repo.Close()
+
+	err := repo.Delete(params.ByName("id"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+
+	w.WriteHeader(204)
+	w.Write([]byte("\n"))
+}
+
+// incidentsHandler lists the incidents; filters: ?status=open|resolved|<state>, ?page=<id>, ?limit= (100 by default)
+func (s *service) incidentsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	filter := ping.IncidentFilter{Status: q.Get("status"), Limit: limit}
+	if p := q.Get("page"); p != "" {
+		if !bson.IsObjectIdHex(p) {
+			WriteError(w, badParam("page", "Page must be an ObjectId."))
+			return
+		}
+		filter.Page = bson.ObjectIdHex(p)
+	}
+
+	repo := s.getIncidentRepo(r)
+	defer repo.Close()
+
+	incidents, err := repo.Incidents(filter)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	type resp struct {
+		Data []*ping.Incident `json:"data"`
+	}
+	json.NewEncoder(w).Encode(resp{Data: incidents})
+}
+
+func (s *service) incidentHandler(w http.ResponseWriter, r *http.Request) {
+	params := context.Get(r, "params").(httprouter.Params)
+
+	repo := s.getIncidentRepo(r)
+	defer repo.Close()
+
+	incident, err := repo.Find(params.ByName("id"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(ping.SingleIncident{Data: *incident})
+}
+
+// createIncidentHandler posts the incident, its message is the first update of the timeline and it's broadcast
+// to the contact groups of the affected pages
+func (s *service) createIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	body := context.Get(r, "body").(*ping.SingleIncident)
+	body.Data.SetInsertDefaults(time.Now())
+	body.Data.CreatedBy = context.Get(r, "principal").(*principal).Name
+
+	if p := projects(r); body.Data.Project == "" && len(p) == 1 {
+		body.Data.Project = p[0]
+	}
+
+	repo := s.getIncidentRepo(r)
+	defer repo.Close()
+
+	err := repo.Create(&body.Data)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	s.broadcastIncident(r, &body.Data, body.Data.Updates[0])
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(body)
+}
+
+// updateIncidentHandler adds the update (investigating/identified/monitoring/resolved + message) to the timeline
+func (s *service) updateIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	params := context.Get(r, "params").(httprouter.Params)
+	body := context.Get(r, "body").(*ping.SingleIncidentUpdate)
+	body.Data.Time = time.Now()
+	body.Data.Author = context.Get(r, "principal").(*principal).Name
+
+	repo := s.getIncidentRepo(r)
+	defer repo.Close()
+
+	incident, err := repo.AddUpdate(params.ByName("id"), body.Data)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	s.broadcastIncident(r, incident, body.Data)
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(ping.SingleIncident{Data: *incident})
+}
+
+// broadcastIncident sends the update with the configured notifiers. The update is already saved,
+// so the failed notifications are only logged
+func (s *service) broadcastIncident(r *http.Request, incident *ping.Incident, update ping.IncidentUpdate) {
+	m := notify.Message{
+		Subject: "[PING] " + incident.Title + " (" + incident.Severity + "): " + update.Status,
+		Text:    update.Message,
+	}
+
+	if len(incident.Pages) > 0 {
+		pageRepo := s.getPageRepo(r)
+		defer pageRepo.Close()
+
+		groups := []bson.ObjectId{}
+		for _, id := range incident.Pages {
+			if p, err := pageRepo.Find(id.Hex()); err == nil {
+				groups = append(groups, p.Data.ContactGroups...)
+			}
+		}
+
+		if len(groups) > 0 {
+			groupRepo := s.getContactGroupRepo(r)
+			defer groupRepo.Close()
+
+			found, err := groupRepo.FindIds(groups)
+			if err != nil {
+				s.log.Warn("cannot find the contact groups", "incident", incident.Id.Hex(), "error", err)
+			}
+			m.ChatIDs, m.Emails = notify.Recipients(found)
+		}
+	}
+
+	if err := notify.Broadcast(s.notifiers, m); err != nil {
+		s.log.Warn("cannot broadcast the incident", "incident", incident.Id.Hex(), "error", err)
+	}
+}
+
+// exportHandler returns the definitions of all the (visible) pages as JSON or, with ?format=yaml, as YAML
+func (s *service) exportHandler(w http.ResponseWriter, r *http.Request) {
+	repo := s.getPageRepo(r)
+	defer repo.Close()
+
+	pages, _, err := repo.Pages(ping.PageFilter{Sort: "name"})
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	f := ping.MonitorFile{Monitors: []ping.Monitor{}}
+	for _, p := range pages {
+		f.Monitors = append(f.Monitors, ping.MonitorFromPage(p))
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+
+	if r.URL.Query().Get("format") == "yaml" {
+		b, err := yaml.Marshal(f)
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-yaml")
+		w.Write(b)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f)
+}
+
+// importHandler applies the YAML or JSON file with the monitors (see the export). With ?dry_run=1 it only returns the plan,
+// with ?prune=1 the pages missing in the file are deleted
+func (s *service) importHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	dryRun := q.Get("dry_run") == "1" || q.Get("dry_run") == "true"
+	prune := q.Get("prune") == "1" || q.Get("prune") == "true"
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		WriteError(w, errBadRequest)
+		return
+	}
+
+	monitors, err := ping.ParseMonitors(data)
+	if err != nil {
+		WriteError(w, errBadRequest)
+		return
+	}
+	for i := range monitors {
+		if p := projects(r); monitors[i].Project == "" && len(p) == 1 {
+			monitors[i].Project = p[0]
+		}
+	}
+
+	repo := s.getPageRepo(r)
+	defer repo.Close()
+
+	pages, _, err := repo.Pages(ping.PageFilter{})
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	plan, err := ping.NewPlan(pages, monitors, prune, projects(r))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	if !dryRun {
+		actor := context.Get(r, "principal").(*principal).Name
+		err = plan.Apply(repo, actor, func(action string, before, after *ping.Page) {
+			s.audit(r, action, before, after)
+		})
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, PUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	type resp struct {
+		Data    *ping.Plan `json:"data"`
+		Applied bool       `json:"applied"`
+	}
+	json.NewEncoder(w).Encode(resp{Data: plan, Applied: !dryRun})
+}
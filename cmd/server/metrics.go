@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tomekwlod/ping"
+)
+
+// the labels of the per page metrics
+var pageLabels = []string{"id", "name", "url", "group"}
+
+var (
+	pageUpDesc       = prometheus.NewDesc("ping_page_up", "Whether the last check of the page was successful (1) or not (0).", pageLabels, nil)
+	pageResponseDesc = prometheus.NewDesc("ping_page_response_seconds", "How long the last check of the page took.", pageLabels, nil)
+	pageCodeDesc     = prometheus.NewDesc("ping_page_status_code", "Status code of the last check of the page.", pageLabels, nil)
+	pageCheckedDesc  = prometheus.NewDesc("ping_page_last_check_timestamp_seconds", "When the page was checked last time.", pageLabels, nil)
+	pageChecksDesc   = prometheus.NewDesc("ping_page_checks_total", "Number of the checks of the page by the result.", append(pageLabels, "result"), nil)
+	pageTLSDesc      = prometheus.NewDesc("ping_page_tls_expiry_days", "Days until the TLS certificate of the page expires.", pageLabels, nil)
+	queueDesc        = prometheus.NewDesc("ping_queue_depth", "Number of the pages waiting for the next run of the checker.", nil, nil)
+	mongoUpDesc      = prometheus.NewDesc("ping_mongodb_up", "Whether MongoDB answered the queries of the last scrape.", nil, nil)
+)
+
+// mongoErrors counts the failed MongoDB queries of the metrics, over all the scrapes
+var mongoErrors = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "ping_mongodb_errors_total",
+	Help: "Number of the failed MongoDB queries.",
+})
+
+// pageCollector reads the state of the pages from the db on every scrape, so the metrics are never older
+// than the last run of the checker
+type pageCollector struct {
+	pages ping.IPageRepository
+}
+
+func (c *pageCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{pageUpDesc, pageResponseDesc, pageCodeDesc, pageCheckedDesc, pageChecksDesc, pageTLSDesc, queueDesc, mongoUpDesc} {
+		ch <- d
+	}
+}
+
+func (c *pageCollector) Collect(ch chan<- prometheus.Metric) {
+	pages, _, err := c.pages.Pages(ping.PageFilter{})
+	if err != nil {
+		c.failed(ch)
+		return
+	}
+
+	now := time.Now()
+	queue := 0
+
+	for _, p := range pages {
+		labels := []string{p.Id.Hex(), p.Name, p.Url, p.Group}
+
+		ch <- prometheus.MustNewConstMetric(pageChecksDesc, prometheus.CounterValue, float64(p.ChecksUp), append(labels, "up")...)
+		ch <- prometheus.MustNewConstMetric(pageChecksDesc, prometheus.CounterValue, float64(p.Checks-p.ChecksUp), append(labels, "down")...)
+
+		if p.Disabled {
+			continue
+		}
+		if !p.NextPing.After(now) {
+			queue++
+		}
+
+		// never checked pages have no state yet
+		if p.Checked.IsZero() {
+			continue
+		}
+
+		up := 0.0
+		if p.Up(p.LastStatus) {
+			up = 1
+		}
+
+		ch <- prometheus.MustNewConstMetric(pageUpDesc, prometheus.GaugeValue, up, labels...)
+		ch <- prometheus.MustNewConstMetric(pageResponseDesc, prometheus.GaugeValue, p.LastLoad, labels...)
+		ch <- prometheus.MustNewConstMetric(pageCodeDesc, prometheus.GaugeValue, float64(p.LastStatus), labels...)
+		ch <- prometheus.MustNewConstMetric(pageCheckedDesc, prometheus.GaugeValue, float64(p.Checked.Unix()), labels...)
+
+		if p.TLSExpiry != nil {
+			ch <- prometheus.MustNewConstMetric(pageTLSDesc, prometheus.GaugeValue, p.TLSExpiry.Sub(now).Hours()/24, labels...)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(queueDesc, prometheus.GaugeValue, float64(queue))
+	ch <- prometheus.MustNewConstMetric(mongoUpDesc, prometheus.GaugeValue, 1)
+}
+
+func (c *pageCollector) failed(ch chan<- prometheus.Metric) {
+	mongoErrors.Inc()
+	ch <- prometheus.MustNewConstMetric(mongoUpDesc, prometheus.GaugeValue, 0)
+}
+
+// metricsHandler serves the metrics in the Prometheus exposition format. The registry is made per request,
+// so the metrics cover only the pages the caller can see
+func (s *service) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	pageRepo := s.getPageRepo(r)
+	defer pageRepo.Close()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&pageCollector{pages: pageRepo}, mongoErrors)
+
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
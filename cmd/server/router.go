@@ -7,28 +7,34 @@ import (
 )
 
 // Router
+// Every route is registered with the minimal role (ping.RoleViewer, ping.RoleEditor, ping.RoleAdmin) required
+// to call it; the role is checked by the authHandler. An empty role means a public route
 type router struct {
 	*httprouter.Router
 }
 
-func (r *router) Get(path string, handler http.Handler) {
-	r.GET(path, wrapHandler(handler))
+func (r *router) Get(path, role string, handler http.Handler) {
+	r.GET(path, wrapHandler(handler, path, role))
 }
 
-func (r *router) Post(path string, handler http.Handler) {
-	r.POST(path, wrapHandler(handler))
+func (r *router) Post(path, role string, handler http.Handler) {
+	r.POST(path, wrapHandler(handler, path, role))
 }
 
-func (r *router) Put(path string, handler http.Handler) {
-	r.PUT(path, wrapHandler(handler))
+func (r *router) Put(path, role string, handler http.Handler) {
+	r.PUT(path, wrapHandler(handler, path, role))
 }
 
-func (r *router) Delete(path string, handler http.Handler) {
-	r.DELETE(path, wrapHandler(handler))
+func (r *router) Patch(path, role string, handler http.Handler) {
+	r.PATCH(path, wrapHandler(handler, path, role))
 }
 
-func (r *router) Options(path string, handler http.Handler) {
-	r.OPTIONS(path, wrapHandler(handler))
+func (r *router) Delete(path, role string, handler http.Handler) {
+	r.DELETE(path, wrapHandler(handler, path, role))
+}
+
+func (r *router) Options(path, role string, handler http.Handler) {
+	r.OPTIONS(path, wrapHandler(handler, path, role))
 }
 
 func NewRouter() *router {
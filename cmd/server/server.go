@@ -4,16 +4,20 @@ package main
 // Webcrawler example: https://github.com/golang/tour/blob/master/solutions/webcrawler.go
 
 import (
-	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/context"
 	"github.com/justinas/alice"
 	"github.com/tomekwlod/ping"
 	"github.com/tomekwlod/ping/db"
+	"github.com/tomekwlod/ping/notify"
+	"github.com/tomekwlod/ping/telemetry"
 	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func mgoHost() (host string) {
@@ -41,15 +45,67 @@ func port() (port string) {
 	return
 }
 
-// service struct to hold the db and the logger
+// service struct to hold the db, the logger and the notifiers
 type service struct {
-	session *mgo.Session
-	logger  *log.Logger
+	session   *mgo.Session
+	log       *slog.Logger
+	notifiers []notify.Notifier
 }
 
 // functions for the service struct
-func (s *service) getPageRepo() ping.IPageRepository {
-	return &ping.PageRepository{Session: s.session.Clone()}
+func (s *service) getPageRepo(r *http.Request) ping.IPageRepository {
+	return &ping.PageRepository{Session: s.session.Clone(), Projects: projects(r)}
+}
+func (s *service) getAuditRepo(r *http.Request) ping.IAuditRepository {
+	return &ping.AuditRepository{Session: s.session.Clone(), Projects: projects(r)}
+}
+func (s *service) getProjectRepo(r *http.Request) ping.IProjectRepository {
+	return &ping.ProjectRepository{Session: s.session.Clone(), Ids: projects(r)}
+}
+func (s *service) getContactGroupRepo(r *http.Request) ping.IContactGroupRepository {
+	return &ping.ContactGroupRepository{Session: s.session.Clone(), Projects: projects(r)}
+}
+func (s *service) getIncidentRepo(r *http.Request) ping.IIncidentRepository {
+	return &ping.IncidentRepository{Session: s.session.Clone(), Projects: projects(r)}
+}
+func (s *service) getPageEntryRepo() ping.IPageEntryRepository {
+	return &ping.PageEntryRepository{Session: s.session.Clone()}
+}
+func (s *service) getAPIKeyRepo() ping.IAPIKeyRepository {
+	return &ping.APIKeyRepository{Session: s.session.Clone()}
+}
+func (s *service) getUserRepo() ping.IUserRepository {
+	return &ping.UserRepository{Session: s.session.Clone()}
+}
+
+// projects returns the projects the caller of the request can work with; nil means all of them
+func projects(r *http.Request) []bson.ObjectId {
+	if p, ok := context.Get(r, "principal").(*principal); ok {
+		return p.Projects
+	}
+
+	return []bson.ObjectId{}
+}
+
+// createAdmin creates the first admin from the PING_ADMIN_USER & PING_ADMIN_PASSWORD envs, only if there are no users yet
+func (s *service) createAdmin() error {
+	username, password := os.Getenv("PING_ADMIN_USER"), os.Getenv("PING_ADMIN_PASSWORD")
+	if username == "" || password == "" {
+		return nil
+	}
+
+	repo := s.getUserRepo()
+	defer repo.Close()
+
+	n, err := repo.Count()
+	if err != nil || n > 0 {
+		return err
+	}
+
+	admin := &ping.User{Username: username, PlainPassword: password, Role: ping.RoleAdmin}
+	admin.SetInsertDefaults(time.Now())
+
+	return repo.Create(admin)
 }
 
 // // init is invoked before main()
@@ -62,25 +118,50 @@ func (s *service) getPageRepo() ping.IPageRepository {
 // }
 
 func main() {
-	// definig the logger & a log file
-	file, err := os.OpenFile("log/http.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	// definig the logger & the log files
+	l, files, err := telemetry.NewLogger("http")
 	if err != nil {
 		log.Fatalln("Failed to open log file", err)
 	}
-	multi := io.MultiWriter(file, os.Stdout)
-	l := log.New(multi, "", log.Ldate|log.Ltime|log.Lshortfile)
+	defer files.Close()
+
+	shutdown, err := telemetry.StartTracing("ping-server")
+	if err != nil {
+		log.Fatalln("Cannot start the tracing", err)
+	}
+	defer shutdown()
 
 	// definging the mongodb session
 	mgoSession, err := db.CreateSession(mgoHost())
-	defer mgoSession.Close()
 	if err != nil {
-		log.Panic("Cannot connect to Mongodb: ", err)
+		l.Error("cannot connect to mongodb", "error", err)
+		os.Exit(1)
 	}
+	defer mgoSession.Close()
 
-	// combine the datastore session and the logger into one struct
+	// combine the datastore session and the loggers into one struct
 	s := &service{
 		session: mgoSession,
-		logger:  l}
+		log:     l}
+
+	// the incident updates are broadcast with the same notifiers as the checker uses; the server works without them
+	s.notifiers, err = notify.FromEnv()
+	if err != nil {
+		l.Warn("notifications are off", "error", err)
+	}
+
+	pageRepo := &ping.PageRepository{Session: mgoSession.Clone()}
+	err = pageRepo.EnsureIndexes()
+	pageRepo.Close()
+	if err != nil {
+		l.Error("cannot create the indexes, are there pages with the same url in a project?", "error", err)
+		os.Exit(1)
+	}
+
+	if err := s.createAdmin(); err != nil {
+		l.Error("cannot create the admin user", "error", err)
+		os.Exit(1)
+	}
 
 	/// testing here start
 	//////////////////////
@@ -105,24 +186,73 @@ func main() {
 	////////////////////
 	/// testing here end
 
-	commonHandlers := alice.New(context.ClearHandler, s.loggingHandler, recoverHandler, acceptHandler)
+	publicHandlers := alice.New(context.ClearHandler, s.loggingHandler, s.recoverHandler, acceptHandler)
+	commonHandlers := publicHandlers.Append(s.authHandler, idHandler)
+	// the files (export/import) can be YAML as well, so any Accept/Content-Type
+	fileHandlers := alice.New(context.ClearHandler, s.loggingHandler, s.recoverHandler, s.authHandler)
 	optionsHandlers := alice.New(context.ClearHandler, s.loggingHandler)
+	htmlHandlers := alice.New(context.ClearHandler, s.loggingHandler, s.recoverHandler)
+	adminHandlers := htmlHandlers.Append(s.uiAuthHandler)
 
 	router := NewRouter()
-	router.Get("/pages", commonHandlers.ThenFunc(s.pagesHandler))
-	router.Get("/page/:id", commonHandlers.ThenFunc(s.pageHandler))
+	router.Get("/pages", ping.RoleViewer, commonHandlers.ThenFunc(s.pagesHandler))
+	router.Get("/page/:id", ping.RoleViewer, commonHandlers.ThenFunc(s.pageHandler))
 	// update
-	router.Put("/page/:id", commonHandlers.Append(contentTypeHandler, bodyHandler(ping.SinglePage{})).ThenFunc(s.updatepageHandler))
+	router.Put("/page/:id", ping.RoleEditor, commonHandlers.Append(contentTypeHandler, bodyHandler(ping.SinglePage{})).ThenFunc(s.updatepageHandler))
 	// create
-	router.Post("/page", commonHandlers.Append(contentTypeHandler, bodyHandler(ping.SinglePage{})).ThenFunc(s.createpageHandler))
+	router.Post("/page", ping.RoleEditor, commonHandlers.Append(contentTypeHandler, bodyHandler(ping.SinglePage{})).ThenFunc(s.createpageHandler))
+	router.Patch("/page/:id", ping.RoleEditor, commonHandlers.Append(contentTypeHandler, bodyHandler(ping.SinglePagePatch{})).ThenFunc(s.patchpageHandler))
 	// delete
-	router.Delete("/page/:id", commonHandlers.ThenFunc(s.deletepageHandler))
-	// -- router.Get("/page/:id/history", commonHandlers.ThenFunc(appC.pageHistoryHandler))
-	router.Options("/*name", optionsHandlers.ThenFunc(allowCorsHandler))
+	router.Delete("/page/:id", ping.RoleEditor, commonHandlers.ThenFunc(s.deletepageHandler))
+	router.Post("/page/:id/restore", ping.RoleEditor, commonHandlers.ThenFunc(s.restorepageHandler))
+	router.Get("/page/:id/history", ping.RoleViewer, commonHandlers.ThenFunc(s.pageHistoryHandler))
+	// monitors as code
+	router.Get("/export", ping.RoleViewer, fileHandlers.ThenFunc(s.exportHandler))
+	router.Post("/import", ping.RoleEditor, fileHandlers.ThenFunc(s.importHandler))
+	router.Get("/audit", ping.RoleViewer, commonHandlers.ThenFunc(s.auditHandler))
+	// api keys
+	router.Get("/apikeys", ping.RoleAdmin, commonHandlers.ThenFunc(s.apiKeysHandler))
+	router.Post("/apikey", ping.RoleAdmin, commonHandlers.Append(contentTypeHandler, bodyHandler(ping.SingleAPIKey{})).ThenFunc(s.createAPIKeyHandler))
+	router.Delete("/apikey/:id", ping.RoleAdmin, commonHandlers.ThenFunc(s.revokeAPIKeyHandler))
+	// projects & contact groups
+	router.Get("/projects", ping.RoleViewer, commonHandlers.ThenFunc(s.projectsHandler))
+	router.Post("/project", ping.RoleAdmin, commonHandlers.Append(contentTypeHandler, bodyHandler(ping.SingleProject{})).ThenFunc(s.createProjectHandler))
+	router.Delete("/project/:id", ping.RoleAdmin, commonHandlers.ThenFunc(s.deleteProjectHandler))
+	router.Get("/contactgroups", ping.RoleViewer, commonHandlers.ThenFunc(s.contactGroupsHandler))
+	router.Post("/contactgroup", ping.RoleAdmin, commonHandlers.Append(contentTypeHandler, bodyHandler(ping.SingleContactGroup{})).ThenFunc(s.createContactGroupHandler))
+	router.Delete("/contactgroup/:id", ping.RoleAdmin, commonHandlers.ThenFunc(s.deleteContactGroupHandler))
+	// incidents
+	router.Get("/incidents", ping.RoleViewer, commonHandlers.ThenFunc(s.incidentsHandler))
+	router.Get("/incident/:id", ping.RoleViewer, commonHandlers.ThenFunc(s.incidentHandler))
+	router.Post("/incident", ping.RoleEditor, commonHandlers.Append(contentTypeHandler, bodyHandler(ping.SingleIncident{})).ThenFunc(s.createIncidentHandler))
+	router.Post("/incident/:id/update", ping.RoleEditor, commonHandlers.Append(contentTypeHandler, bodyHandler(ping.SingleIncidentUpdate{})).ThenFunc(s.updateIncidentHandler))
+	// users & sessions
+	router.Post("/login", "", publicHandlers.Append(contentTypeHandler, bodyHandler(ping.SingleUser{})).ThenFunc(s.loginHandler))
+	router.Post("/logout", ping.RoleViewer, commonHandlers.ThenFunc(s.logoutHandler))
+	router.Get("/users", ping.RoleAdmin, commonHandlers.ThenFunc(s.usersHandler))
+	router.Post("/user", ping.RoleAdmin, commonHandlers.Append(contentTypeHandler, bodyHandler(ping.SingleUser{})).ThenFunc(s.createUserHandler))
+	router.Delete("/user/:id", ping.RoleAdmin, commonHandlers.ThenFunc(s.deleteUserHandler))
+	// prometheus (text format, so no Accept check)
+	router.Get("/metrics", ping.RoleViewer, fileHandlers.ThenFunc(s.metricsHandler))
+	// public status page
+	router.Get("/status", "", htmlHandlers.ThenFunc(s.statusHandler))
+	// admin ui
+	router.Get("/admin/login", "", htmlHandlers.ThenFunc(s.adminLoginFormHandler))
+	router.Post("/admin/login", "", htmlHandlers.ThenFunc(s.adminLoginHandler))
+	router.Post("/admin/logout", "", htmlHandlers.ThenFunc(s.adminLogoutHandler))
+	router.Get("/admin", ping.RoleViewer, adminHandlers.ThenFunc(s.adminPagesHandler))
+	router.Get("/admin/new", ping.RoleEditor, adminHandlers.ThenFunc(s.adminNewPageHandler))
+	router.Post("/admin/page", ping.RoleEditor, adminHandlers.ThenFunc(s.adminCreatePageHandler))
+	router.Get("/admin/page/:id", ping.RoleViewer, adminHandlers.ThenFunc(s.adminPageHandler))
+	router.Post("/admin/page/:id", ping.RoleEditor, adminHandlers.ThenFunc(s.adminUpdatePageHandler))
+	router.Post("/admin/page/:id/pause", ping.RoleEditor, adminHandlers.ThenFunc(s.adminPausePageHandler))
+	router.Post("/admin/page/:id/check", ping.RoleEditor, adminHandlers.ThenFunc(s.adminCheckPageHandler))
+	router.Options("/*name", "", optionsHandlers.ThenFunc(allowCorsHandler))
 
-	// curl -X POST -H 'Accept: application/json' -H 'Content-Type: application/json' -d '{"data": {"url":"http://website.com/api", "status":0, "interval":1}}' localhost:8080/page
-	l.Printf("Server started and listening on port %s. Ready for the requests.\n\n", port())
+	// curl -X POST -H 'Accept: application/json' -H 'Content-Type: application/json' -H 'Authorization: Bearer <key>' -d '{"data": {"url":"http://website.com/api", "status":0, "interval":1}}' localhost:8080/page
+	l.Info("server started and listening, ready for the requests", "port", port())
 	if err := http.ListenAndServe(":"+port(), router); err != nil {
-		l.Panic("Error occured: ", err)
+		l.Error("server stopped", "error", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomekwlod/ping"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// the number of days on the uptime bars of the status page
+const statusDays = 90
+
+// how long the resolved incidents stay on the status page
+const statusIncidentDays = 7
+
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"since": since,
+	"join":  strings.Join,
+	"list":  func(s ...string) []string { return s },
+}).ParseFS(templatesFS, "templates/*.html"))
+
+// statusConfig is the configuration of the public status page, taken from the env:
+// STATUS_TITLE, STATUS_LOGO (url of the image), STATUS_PAGES (slugs or ids) and STATUS_GROUPS (comma separated)
+type statusConfig struct {
+	Title  string
+	Logo   string
+	Pages  []string
+	Groups []string
+}
+
+func loadStatusConfig() statusConfig {
+	c := statusConfig{
+		Title:  os.Getenv("STATUS_TITLE"),
+		Logo:   os.Getenv("STATUS_LOGO"),
+		Pages:  splitList(os.Getenv("STATUS_PAGES")),
+		Groups: splitList(os.Getenv("STATUS_GROUPS")),
+	}
+	if c.Title == "" {
+		c.Title = "Status"
+	}
+
+	return c
+}
+
+// selects tells if the page is one of the pages (or groups) of the status page
+func (c statusConfig) selects(p *ping.Page) bool {
+	for _, s := range c.Pages {
+		if s == p.Slug || s == p.Id.Hex() {
+			return true
+		}
+	}
+	for _, g := range c.Groups {
+		if g == p.Group {
+			return true
+		}
+	}
+
+	return false
+}
+
+func splitList(s string) []string {
+	list := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+// statusBar is one day on the uptime bar
+type statusBar struct {
+	Day     string
+	Percent float64
+	NoData  bool
+}
+
+// Class is the css class (color) of the bar
+func (b statusBar) Class() string {
+	switch {
+	case b.NoData:
+		return "nodata"
+	case b.Percent >= 99.9:
+		return "up"
+	case b.Percent >= 99:
+		return "minor"
+	case b.Percent >= 95:
+		return "major"
+	}
+
+	return "down"
+}
+
+type statusService struct {
+	Page   *ping.Page
+	Up     bool
+	NoData bool    // the page was never checked, it's neither up nor down
+	Uptime float64 // over all the days with the data
+	Bars   []statusBar
+}
+
+// statusOutage is the page which is down right now
+type statusOutage struct {
+	Page  *ping.Page
+	Since time.Time // when it went down: the start of its auto-detected incident, the last check without one
+}
+
+type statusData struct {
+	Config    statusConfig
+	Services  []statusService
+	Incidents []statusOutage   // the pages which are down right now
+	Posts     []*ping.Incident // the incidents posted by the operators, open or recently resolved
+	Updated   time.Time
+}
+
+// Operational tells if there is nothing to worry about
+func (d statusData) Operational() bool {
+	if len(d.Incidents) > 0 {
+		return false
+	}
+	for _, p := range d.Posts {
+		if !p.Resolved() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// statusHandler renders the public, read-only status page. It needs no authentication
+func (s *service) statusHandler(w http.ResponseWriter, r *http.Request) {
+	cnf := loadStatusConfig()
+
+	// the status page is public, it's not limited to any project
+	repo := &ping.PageRepository{Session: s.session.Clone()}
+	defer repo.Close()
+
+	pages, _, err := repo.Pages(ping.PageFilter{Sort: "name"})
+	if err != nil {
+		s.htmlFail(w, err)
+		return
+	}
+
+	data := statusData{Config: cnf, Services: []statusService{}, Incidents: []statusOutage{}, Updated: time.Now()}
+
+	ids := []bson.ObjectId{}
+	for _, p := range pages {
+		if p.Disabled || !cnf.selects(p) {
+			continue
+		}
+
+		ids = append(ids, p.Id)
+		if p.Checked.IsZero() {
+			data.Services = append(data.Services, statusService{Page: p, NoData: true})
+			continue
+		}
+
+		data.Services = append(data.Services, statusService{Page: p, Up: p.Up(p.LastStatus)})
+		if !p.Up(p.LastStatus) {
+			data.Incidents = append(data.Incidents, statusOutage{Page: p, Since: p.Checked})
+		}
+	}
+
+	posts, starts, err := s.statusPosts(ids)
+	if err != nil {
+		s.htmlFail(w, err)
+		return
+	}
+	data.Posts = posts
+	for i, o := range data.Incidents {
+		if t, ok := starts[o.Page.Id]; ok {
+			data.Incidents[i].Since = t
+		}
+	}
+
+	entryRepo := s.getPageEntryRepo()
+	defer entryRepo.Close()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	first := today.AddDate(0, 0, -(statusDays - 1))
+
+	uptime, err := entryRepo.DailyUptime(ids, first)
+	if err != nil {
+		s.htmlFail(w, err)
+		return
+	}
+
+	for i := range data.Services {
+		svc := &data.Services[i]
+		days := uptime[svc.Page.Id]
+
+		checks, up := 0, 0
+		for d := first; !d.After(today); d = d.AddDate(0, 0, 1) {
+			day := d.Format("2006-01-02")
+
+			u, ok := days[day]
+			svc.Bars = append(svc.Bars, statusBar{Day: day, Percent: u.Percent(), NoData: !ok})
+
+			checks += u.Checks
+			up += u.Up
+		}
+
+		svc.Uptime = ping.DayUptime{Checks: checks, Up: up}.Percent()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := templates.ExecuteTemplate(w, "status.html", data); err != nil {
+		s.log.Error("cannot render the template", "error", err)
+	}
+}
+
+// statusPosts are the manual incidents for the status page: the ones about the shown pages and the ones posted
+// as public. The other incidents (eg. of the other projects) are not public. The starts are the times the shown
+// pages went down, by their open auto-detected incidents
+func (s *service) statusPosts(shown []bson.ObjectId) (posts []*ping.Incident, starts map[bson.ObjectId]time.Time, err error) {
+	repo := &ping.IncidentRepository{Session: s.session.Clone()}
+	defer repo.Close()
+
+	incidents, err := repo.Incidents(ping.IncidentFilter{Since: time.Now().AddDate(0, 0, -statusIncidentDays)})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	posts, starts = []*ping.Incident{}, map[bson.ObjectId]time.Time{}
+	for _, i := range incidents {
+		if !i.Auto {
+			if i.Public || containsId(shown, i.Pages) {
+				posts = append(posts, i)
+			}
+			continue
+		}
+
+		// there is one open auto-detected incident of the page while it's down
+		if !i.Resolved() {
+			for _, p := range i.Pages {
+				starts[p] = i.Created
+			}
+		}
+	}
+
+	return posts, starts, nil
+}
+
+// containsId tells if any of the ids is in the list
+func containsId(list, ids []bson.ObjectId) bool {
+	for _, a := range list {
+		for _, b := range ids {
+			if a == b {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// since is the "X min ago" form of the time
+func since(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return pluralize(int(d.Minutes()), "min") + " ago"
+	case d < 24*time.Hour:
+		return pluralize(int(d.Hours()), "hour") + " ago"
+	}
+
+	return pluralize(int(d.Hours()/24), "day") + " ago"
+}
+
+func pluralize(n int, unit string) string {
+	s := strconv.Itoa(n) + " " + unit
+	if n != 1 {
+		s += "s"
+	}
+
+	return s
+}
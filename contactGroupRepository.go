@@ -0,0 +1,83 @@
+package ping
+
+import (
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	contactGroupCollection = "contact_groups"
+)
+
+// IContactGroupRepository exposes the methods for the ContactGroupRepository
+type IContactGroupRepository interface {
+	Groups() ([]*ContactGroup, error)
+	FindIds(IDs []bson.ObjectId) ([]*ContactGroup, error)
+	Create(*ContactGroup) error
+	Delete(ID string) error
+	Close()
+}
+
+// ContactGroupRepository works only with the groups of the given Projects; nil means all of them
+type ContactGroupRepository struct {
+	Session  *mgo.Session
+	Projects []bson.ObjectId
+}
+
+func (repo *ContactGroupRepository) Close() {
+	repo.Session.Close()
+}
+
+// ContactGroup is who gets notified about the pages which point to this group
+type ContactGroup struct {
+	DocumentBase   `bson:",inline"`
+	Project        bson.ObjectId `json:"project" bson:"project"`
+	Name           string        `json:"name" bson:"name"`
+	TelegramChatID string        `json:"telegram_chatid,omitempty" bson:"telegram_chatid,omitempty"`
+	Emails         []string      `json:"emails,omitempty" bson:"emails,omitempty"`
+}
+type SingleContactGroup struct {
+	Data ContactGroup `json:"data"`
+}
+
+func (r *ContactGroupRepository) Groups() (groups []*ContactGroup, err error) {
+	err = r.collection().Find(scope(bson.M{}, "project", r.Projects)).Sort("name").All(&groups)
+
+	return groups, dbError(err, "Contact group")
+}
+
+func (r *ContactGroupRepository) FindIds(ids []bson.ObjectId) (groups []*ContactGroup, err error) {
+	err = r.collection().Find(scope(bson.M{"_id": bson.M{"$in": ids}}, "project", r.Projects)).All(&groups)
+
+	return groups, dbError(err, "Contact group")
+}
+
+func (r *ContactGroupRepository) Create(group *ContactGroup) error {
+	if group.Name == "" {
+		return invalid("Contact group cannot be created without the name")
+	}
+	if group.Project == "" {
+		return invalid("Contact group cannot be created without the project")
+	}
+	if !inProjects(group.Project, r.Projects) {
+		return invalid("Contact group must belong to one of your projects")
+	}
+
+	group.Id = bson.NewObjectId()
+
+	return dbError(r.collection().Insert(group), "Contact group")
+}
+
+func (r *ContactGroupRepository) Delete(id string) error {
+	oid, err := objectId(id, "Contact group")
+	if err != nil {
+		return err
+	}
+
+	return dbError(r.collection().Remove(scope(bson.M{"_id": oid}, "project", r.Projects)), "Contact group")
+}
+
+// unexported methods
+func (repo *ContactGroupRepository) collection() *mgo.Collection {
+	return repo.Session.DB("").C(contactGroupCollection)
+}
@@ -1,7 +1,9 @@
 package ping
 
 import (
+	"strings"
 	"time"
+	"unicode"
 
 	"gopkg.in/mgo.v2/bson"
 )
@@ -19,3 +21,21 @@ func (d *DocumentBase) SetInsertDefaults(t time.Time) {
 func (d *DocumentBase) SetUpdateDefaults(t time.Time) {
 	d.Modified = t
 }
+
+// Slugify turns the name into a lowercase, url friendly identifier, eg. "My Project #1" -> "my-project-1"
+func Slugify(name string) string {
+	var sb strings.Builder
+
+	dash := false
+	for _, c := range strings.ToLower(name) {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			sb.WriteRune(c)
+			dash = false
+		} else if !dash && sb.Len() > 0 {
+			sb.WriteRune('-')
+			dash = true
+		}
+	}
+
+	return strings.TrimRight(sb.String(), "-")
+}
@@ -0,0 +1,34 @@
+package ping
+
+import "gopkg.in/mgo.v2/bson"
+
+// The checker keeps the real status code of every check (the history, the incidents, the notifications and the
+// metrics show what the page really answered), and the page decides if the code is the successful one. Most pages
+// answer 200, but an endpoint may be healthy with another code (eg. 204 of the health checks or 401 of the
+// protected api, the expected statuses of the imported specs); such a page sets its DesiredStatus. Everything
+// which tells up from down (the quorum, the incidents, the content check, the status page...) goes through the Up.
+
+// DesiredCode is the code of the successful check: the DesiredStatus of the http page (200 when not set), 200 for
+// the other types, which map their results onto the http codes
+func (p *Page) DesiredCode() int {
+	if (p.Type == "" || p.Type == CheckHTTP) && p.DesiredStatus != 0 {
+		return p.DesiredStatus
+	}
+
+	return 200
+}
+
+// Up tells if the code of the check is the successful one
+func (p *Page) Up(code int) bool {
+	return code == p.DesiredCode()
+}
+
+// pageUp is the Up of the page by its laststatus as the db expression (see the DesiredCode), for the queries
+var pageUp = bson.M{"$eq": []interface{}{"$laststatus", bson.M{"$cond": []interface{}{
+	bson.M{"$and": []interface{}{
+		bson.M{"$in": []interface{}{bson.M{"$ifNull": []interface{}{"$type", ""}}, []string{"", CheckHTTP}}},
+		bson.M{"$gt": []interface{}{bson.M{"$ifNull": []interface{}{"$desiredstatus", 0}}, 0}},
+	}},
+	"$desiredstatus",
+	200,
+}}}}
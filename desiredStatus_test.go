@@ -0,0 +1,32 @@
+package ping
+
+import "testing"
+
+func TestPageUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     string
+		desired int
+		code    int
+		up      bool
+	}{
+		{"http 200", "", 0, 200, true},
+		{"http 503", "", 0, 503, false},
+		{"desired 204", CheckHTTP, 204, 204, true},
+		{"desired 204, got 200", CheckHTTP, 204, 200, false},
+		{"desired 401", "", 401, 401, true},
+		{"grpc ignores the desired status", CheckGRPC, 204, 200, true},
+		{"grpc failing", CheckGRPC, 204, 204, false},
+		{"status page ignores the desired status", CheckStatusPage, 204, 200, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := &Page{Type: tt.typ, DesiredStatus: tt.desired}
+
+			if up := page.Up(tt.code); up != tt.up {
+				t.Errorf("Up(%d) = %v, want %v", tt.code, up, tt.up)
+			}
+		})
+	}
+}
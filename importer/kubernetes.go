@@ -0,0 +1,202 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tomekwlod/ping"
+	"sigs.k8s.io/yaml"
+)
+
+// the annotation with the public hostname(s) of a service, used by external-dns
+const hostnameAnnotation = "external-dns.alpha.kubernetes.io/hostname"
+
+type k8sObject struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		// Ingress
+		TLS []struct {
+			Hosts []string `json:"hosts"`
+		} `json:"tls"`
+		Rules []struct {
+			Host string `json:"host"`
+		} `json:"rules"`
+
+		// Service
+		Type         string `json:"type"`
+		ExternalName string `json:"externalName"`
+		Ports        []struct {
+			Port int `json:"port"`
+		} `json:"ports"`
+	} `json:"spec"`
+	Status struct {
+		LoadBalancer struct {
+			Ingress []struct {
+				IP       string `json:"ip"`
+				Hostname string `json:"hostname"`
+			} `json:"ingress"`
+		} `json:"loadBalancer"`
+	} `json:"status"`
+
+	// kind: List
+	Items []k8sObject `json:"items"`
+}
+
+// Kubernetes creates the monitors for the hosts of the Ingress and Service manifests (multi-document YAML).
+// The other kinds are skipped
+func Kubernetes(data []byte) ([]ping.Monitor, error) {
+	monitors := []ping.Monitor{}
+
+	for _, doc := range splitDocuments(data) {
+		obj := k8sObject{}
+		if err := yaml.Unmarshal(doc, &obj); err != nil {
+			return nil, err
+		}
+
+		monitors = append(monitors, k8sMonitors(obj)...)
+	}
+
+	return monitors, nil
+}
+
+func k8sMonitors(obj k8sObject) []ping.Monitor {
+	monitors := []ping.Monitor{}
+
+	switch obj.Kind {
+	case "List":
+		for _, item := range obj.Items {
+			monitors = append(monitors, k8sMonitors(item)...)
+		}
+	case "Ingress":
+		tls := map[string]bool{}
+		for _, t := range obj.Spec.TLS {
+			for _, h := range t.Hosts {
+				tls[h] = true
+			}
+		}
+
+		seen := map[string]bool{}
+		for _, rule := range obj.Spec.Rules {
+			if rule.Host == "" || strings.Contains(rule.Host, "*") || seen[rule.Host] {
+				continue
+			}
+			seen[rule.Host] = true
+
+			scheme := "http://"
+			if tls[rule.Host] {
+				scheme = "https://"
+			}
+
+			monitors = append(monitors, k8sMonitor(obj, rule.Host, scheme+rule.Host+"/"))
+		}
+	case "Service":
+		port := 80
+		if len(obj.Spec.Ports) > 0 {
+			port = obj.Spec.Ports[0].Port
+		}
+
+		for _, host := range serviceHosts(obj) {
+			monitors = append(monitors, k8sMonitor(obj, host, serviceUrl(host, port)))
+		}
+	}
+
+	return monitors
+}
+
+// serviceHosts returns the public hosts of the service: from the external-dns annotation, the external name
+// or the load balancer status. The internal (ClusterIP) services have none
+func serviceHosts(obj k8sObject) []string {
+	hosts := []string{}
+
+	if a := obj.Metadata.Annotations[hostnameAnnotation]; a != "" {
+		for _, h := range strings.Split(a, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				hosts = append(hosts, h)
+			}
+		}
+
+		return hosts
+	}
+
+	if obj.Spec.Type == "ExternalName" && obj.Spec.ExternalName != "" {
+		return append(hosts, obj.Spec.ExternalName)
+	}
+
+	if obj.Spec.Type == "LoadBalancer" {
+		for _, i := range obj.Status.LoadBalancer.Ingress {
+			if i.Hostname != "" {
+				hosts = append(hosts, i.Hostname)
+			} else if i.IP != "" {
+				hosts = append(hosts, i.IP)
+			}
+		}
+	}
+
+	return hosts
+}
+
+func serviceUrl(host string, port int) string {
+	switch port {
+	case 443:
+		return "https://" + host + "/"
+	case 80:
+		return "http://" + host + "/"
+	}
+
+	return "http://" + host + ":" + strconv.Itoa(port) + "/"
+}
+
+func k8sMonitor(obj k8sObject, host, url string) ping.Monitor {
+	namespace := obj.Metadata.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	name := namespace + "/" + obj.Metadata.Name
+
+	return ping.Monitor{
+		Slug:        ping.Slugify(strings.ToLower(obj.Kind) + " " + name + " " + host),
+		Name:        host,
+		Description: obj.Kind + " " + name,
+		Url:         url,
+		Interval:    defaultInterval,
+		Tags:        []string{"kubernetes", strings.ToLower(obj.Kind)},
+		Group:       namespace,
+	}
+}
+
+// splitDocuments splits the multi-document YAML on the --- lines; the line has to be --- alone or followed by
+// a whitespace (eg. a comment), so the text starting with --- (eg. in a block scalar) stays where it is
+func splitDocuments(data []byte) [][]byte {
+	docs := [][]byte{}
+	current := bytes.Buffer{}
+
+	flush := func() {
+		if len(bytes.TrimSpace(current.Bytes())) > 0 {
+			docs = append(docs, append([]byte{}, current.Bytes()...))
+		}
+		current.Reset()
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "---" || strings.HasPrefix(line, "---") && unicode.IsSpace(rune(line[3])) {
+			flush()
+			continue
+		}
+
+		current.WriteString(line + "\n")
+	}
+	flush()
+
+	return docs
+}
@@ -0,0 +1,144 @@
+package importer
+
+import "testing"
+
+const manifests = `apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+  namespace: shop
+spec:
+  tls:
+    - hosts: [shop.example.com]
+  rules:
+    - host: shop.example.com
+    - host: admin.example.com
+    - host: shop.example.com
+    - host: "*.example.com"
+    - http: {}
+--- # the services
+apiVersion: v1
+kind: Service
+metadata:
+  name: api
+  annotations:
+    external-dns.alpha.kubernetes.io/hostname: "api.example.com, api2.example.com"
+spec:
+  ports:
+    - port: 443
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: lb
+  namespace: shop
+spec:
+  type: LoadBalancer
+  ports:
+    - port: 8080
+status:
+  loadBalancer:
+    ingress:
+      - ip: 10.0.0.1
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: internal
+spec:
+  ports:
+    - port: 80
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  notes: |
+    ---not a separator
+    ---also not
+`
+
+func TestKubernetes(t *testing.T) {
+	monitors, err := Kubernetes([]byte(manifests))
+	if err != nil {
+		t.Fatalf("Kubernetes() error = %v", err)
+	}
+
+	want := []struct {
+		url, name, slug, group string
+	}{
+		{"https://shop.example.com/", "shop.example.com", "ingress-shop-web-shop-example-com", "shop"},
+		{"http://admin.example.com/", "admin.example.com", "ingress-shop-web-admin-example-com", "shop"},
+		{"https://api.example.com/", "api.example.com", "service-default-api-api-example-com", "default"},
+		{"https://api2.example.com/", "api2.example.com", "service-default-api-api2-example-com", "default"},
+		{"http://10.0.0.1:8080/", "10.0.0.1", "service-shop-lb-10-0-0-1", "shop"},
+	}
+	if len(monitors) != len(want) {
+		t.Fatalf("Kubernetes() = %d monitors (%v), want %d", len(monitors), monitors, len(want))
+	}
+	for i, w := range want {
+		m := monitors[i]
+		if m.Url != w.url || m.Name != w.name || m.Slug != w.slug || m.Group != w.group {
+			t.Errorf("Kubernetes()[%d] = %s %s %s %s, want %s %s %s %s", i, m.Url, m.Name, m.Slug, m.Group, w.url, w.name, w.slug, w.group)
+		}
+	}
+}
+
+func TestKubernetesList(t *testing.T) {
+	list := `kind: List
+items:
+  - kind: Service
+    metadata:
+      name: ext
+    spec:
+      type: ExternalName
+      externalName: db.example.com
+      ports:
+        - port: 5432
+`
+	monitors, err := Kubernetes([]byte(list))
+	if err != nil {
+		t.Fatalf("Kubernetes() error = %v", err)
+	}
+	if len(monitors) != 1 || monitors[0].Url != "http://db.example.com:5432/" {
+		t.Errorf("Kubernetes() = %v, want the monitor of the external name", monitors)
+	}
+}
+
+func TestKubernetesInvalid(t *testing.T) {
+	if _, err := Kubernetes([]byte("kind: [Service")); err == nil {
+		t.Error("Kubernetes() of the broken yaml, want an error")
+	}
+}
+
+func TestSplitDocuments(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"single", "a: 1\n", []string{"a: 1\n"}},
+		{"separated", "a: 1\n---\nb: 2\n", []string{"a: 1\n", "b: 2\n"}},
+		{"leading and trailing", "---\na: 1\n---\n", []string{"a: 1\n"}},
+		{"empty documents", "---\n---\n\n---\na: 1", []string{"a: 1\n"}},
+		{"with a comment", "a: 1\n--- # next\nb: 2\n", []string{"a: 1\n", "b: 2\n"}},
+		{"trailing spaces", "a: 1\n---  \nb: 2\n", []string{"a: 1\n", "b: 2\n"}},
+		{"crlf", "a: 1\r\n---\r\nb: 2\r\n", []string{"a: 1\n", "b: 2\n"}},
+		{"not a separator", "a: |\n  x\n---b\n----\n", []string{"a: |\n  x\n---b\n----\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitDocuments([]byte(tt.in))
+			if len(got) != len(tt.want) {
+				t.Fatalf("splitDocuments() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if string(got[i]) != tt.want[i] {
+					t.Errorf("splitDocuments()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
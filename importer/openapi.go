@@ -0,0 +1,149 @@
+package importer
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tomekwlod/ping"
+	"sigs.k8s.io/yaml"
+)
+
+// the interval (minutes) of the imported monitors
+const defaultInterval = 5
+
+type openAPIDoc struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title string `json:"title"`
+	} `json:"info"`
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths map[string]struct {
+		Parameters []openAPIParameter `json:"parameters"`
+		Get        *openAPIOperation  `json:"get"`
+	} `json:"paths"`
+}
+
+type openAPIOperation struct {
+	Summary    string                 `json:"summary"`
+	Tags       []string               `json:"tags"`
+	Parameters []openAPIParameter     `json:"parameters"`
+	Responses  map[string]interface{} `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Ref      string `json:"$ref"`
+	In       string `json:"in"`
+	Required bool   `json:"required"`
+}
+
+// OpenAPI creates the GET monitors for the endpoints of the OpenAPI 3 document (YAML or JSON) which can be called
+// without any parameters. The expected status is the first successful one of the spec. The base url is needed only
+// if the document has no absolute servers; the relative server url (eg. /v1) is joined onto it
+func OpenAPI(data []byte, base string) ([]ping.Monitor, error) {
+	doc := openAPIDoc{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, errors.New("Only the OpenAPI 3 documents are supported")
+	}
+
+	base = serverUrl(doc, base)
+	if !strings.HasPrefix(base, "http://") && !strings.HasPrefix(base, "https://") {
+		return nil, errors.New("The document has no absolute server url, the base url must be given")
+	}
+
+	paths := []string{}
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	monitors := []ping.Monitor{}
+	for _, path := range paths {
+		item := doc.Paths[path]
+		op := item.Get
+
+		if op == nil || strings.Contains(path, "{") || needsParameters(item.Parameters) || needsParameters(op.Parameters) {
+			continue
+		}
+
+		name := "GET " + path
+		if op.Summary != "" {
+			name = op.Summary
+		}
+
+		monitors = append(monitors, ping.Monitor{
+			Slug:          ping.Slugify(doc.Info.Title + " " + path),
+			Name:          name,
+			Description:   "GET " + path + " of " + doc.Info.Title,
+			Url:           base + path,
+			Interval:      defaultInterval,
+			DesiredStatus: successStatus(op.Responses),
+			Tags:          append([]string{"openapi"}, op.Tags...),
+			Group:         doc.Info.Title,
+		})
+	}
+
+	return monitors, nil
+}
+
+// serverUrl is the url the paths of the document are joined onto, without the trailing slash: the given base
+// (with the relative server url of the document, if any) or the absolute server url of the document
+func serverUrl(doc openAPIDoc, base string) string {
+	server := ""
+	if len(doc.Servers) > 0 {
+		server = doc.Servers[0].URL
+	}
+
+	switch {
+	case base == "":
+		base = server
+	case server != "" && !strings.Contains(server, "://"):
+		base = strings.TrimRight(base, "/") + "/" + strings.TrimLeft(server, "/")
+	}
+
+	return strings.TrimRight(base, "/")
+}
+
+// needsParameters tells if any of the parameters has to be given. The referenced ones are not resolved,
+// so they count as the required ones
+func needsParameters(params []openAPIParameter) bool {
+	for _, p := range params {
+		if p.Ref != "" || p.Required || p.In == "path" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// successStatus is the lowest 2xx status of the responses, 200 if there is no explicit one
+func successStatus(responses map[string]interface{}) int {
+	status := 0
+
+	for code := range responses {
+		if strings.ToUpper(code) == "2XX" {
+			code = "200"
+		}
+
+		c, err := strconv.Atoi(code)
+		if err != nil || c < 200 || c > 299 {
+			continue
+		}
+		if status == 0 || c < status {
+			status = c
+		}
+	}
+
+	if status == 0 {
+		return 200
+	}
+
+	return status
+}
@@ -0,0 +1,162 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+const petstore = `
+openapi: 3.0.1
+info:
+  title: Pet Store
+servers:
+  - url: %s
+paths:
+  /pets:
+    get:
+      summary: List the pets
+      tags: [pets]
+      responses:
+        "200": {}
+  /pets/{id}:
+    get:
+      responses:
+        "200": {}
+  /health:
+    get:
+      responses:
+        "204": {}
+        "500": {}
+  /search:
+    get:
+      parameters:
+        - in: query
+          name: q
+          required: true
+      responses:
+        "200": {}
+  /owners:
+    parameters:
+      - $ref: '#/components/parameters/Tenant'
+    get:
+      responses:
+        "200": {}
+  /version:
+    get:
+      parameters:
+        - in: query
+          name: verbose
+      responses:
+        2XX: {}
+  /login:
+    post:
+      responses:
+        "200": {}
+`
+
+func petstoreWith(server string) []byte {
+	return []byte(strings.Replace(petstore, "%s", server, 1))
+}
+
+func TestOpenAPI(t *testing.T) {
+	tests := []struct {
+		name   string
+		server string
+		base   string
+		url    string // of the /pets
+		err    bool
+	}{
+		{"absolute server", "https://api.example.com/v2/", "", "https://api.example.com/v2/pets", false},
+		{"base over absolute server", "https://api.example.com/v2", "http://localhost:8080", "http://localhost:8080/pets", false},
+		{"relative server joined", "/v1", "https://api.example.com", "https://api.example.com/v1/pets", false},
+		{"relative server joined, slashes", "/v1/", "https://api.example.com/", "https://api.example.com/v1/pets", false},
+		{"relative server without base", "/v1", "", "", true},
+		{"no server, base", "", "https://api.example.com", "https://api.example.com/pets", false},
+		{"no server, no base", "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitors, err := OpenAPI(petstoreWith(tt.server), tt.base)
+			if tt.err {
+				if err == nil {
+					t.Errorf("OpenAPI() = %v, want an error", monitors)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OpenAPI() error = %v", err)
+			}
+
+			urls := map[string]int{}
+			for _, m := range monitors {
+				urls[m.Url] = m.DesiredStatus
+			}
+			if _, ok := urls[tt.url]; !ok {
+				t.Errorf("OpenAPI() urls = %v, want %s", urls, tt.url)
+			}
+		})
+	}
+}
+
+func TestOpenAPIMonitors(t *testing.T) {
+	monitors, err := OpenAPI(petstoreWith("https://api.example.com"), "")
+	if err != nil {
+		t.Fatalf("OpenAPI() error = %v", err)
+	}
+
+	// sorted by the path; the ones with the path, required or referenced parameters and not GET are skipped
+	want := []struct {
+		url, name, slug string
+		status          int
+	}{
+		{"https://api.example.com/health", "GET /health", "pet-store-health", 204},
+		{"https://api.example.com/pets", "List the pets", "pet-store-pets", 200},
+		{"https://api.example.com/version", "GET /version", "pet-store-version", 200},
+	}
+	if len(monitors) != len(want) {
+		t.Fatalf("OpenAPI() = %d monitors (%v), want %d", len(monitors), monitors, len(want))
+	}
+	for i, w := range want {
+		m := monitors[i]
+		if m.Url != w.url || m.Name != w.name || m.Slug != w.slug || m.DesiredStatus != w.status {
+			t.Errorf("OpenAPI()[%d] = %s %q %s %d, want %s %q %s %d", i, m.Url, m.Name, m.Slug, m.DesiredStatus, w.url, w.name, w.slug, w.status)
+		}
+		if m.Group != "Pet Store" || m.Interval != defaultInterval || m.Tags[0] != "openapi" {
+			t.Errorf("OpenAPI()[%d] = %+v, want the defaults", i, m)
+		}
+	}
+}
+
+func TestOpenAPINotVersion3(t *testing.T) {
+	if _, err := OpenAPI([]byte(`swagger: "2.0"`), "https://api.example.com"); err == nil {
+		t.Error("OpenAPI() of the swagger 2 document, want an error")
+	}
+}
+
+func TestSuccessStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []string
+		want      int
+	}{
+		{"none", nil, 200},
+		{"only errors", []string{"400", "default"}, 200},
+		{"lowest 2xx", []string{"204", "201", "500"}, 201},
+		{"range", []string{"2XX"}, 200},
+		{"range and 202", []string{"2xx", "202"}, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := map[string]interface{}{}
+			for _, r := range tt.responses {
+				responses[r] = nil
+			}
+
+			if got := successStatus(responses); got != tt.want {
+				t.Errorf("successStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package ping
+
+import (
+	"strconv"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	incidentCollection = "incidents"
+)
+
+// Incident states, the timeline of an incident goes through them in this order (some can be skipped)
+const (
+	IncidentInvestigating = "investigating"
+	IncidentIdentified    = "identified"
+	IncidentMonitoring    = "monitoring"
+	IncidentResolved      = "resolved"
+)
+
+// Incident severities
+const (
+	SeverityMinor    = "minor"
+	SeverityMajor    = "major"
+	SeverityCritical = "critical"
+)
+
+// IIncidentRepository exposes the methods for the IncidentRepository
+type IIncidentRepository interface {
+	Incidents(IncidentFilter) ([]*Incident, error)
+	Find(ID string) (*Incident, error)
+	Create(*Incident) error
+	AddUpdate(ID string, update IncidentUpdate) (*Incident, error)
+	OpenAuto(page *Page, code int) error
+	ResolveAuto(page *Page) error
+	Close()
+}
+
+// IncidentRepository works only with the incidents of the given Projects; nil means all of them
+type IncidentRepository struct {
+	Session  *mgo.Session
+	Projects []bson.ObjectId
+}
+
+func (repo *IncidentRepository) Close() {
+	repo.Session.Close()
+}
+
+// Incident is either posted by the operators (with the updates of its timeline) or opened automatically by the checker
+// when a page goes down. The manual incidents can be linked to the automatic ones they explain
+type Incident struct {
+	DocumentBase `bson:",inline"`
+	Title        string           `json:"title" bson:"title"`
+	Severity     string           `json:"severity" bson:"severity"`
+	Status       string           `json:"status" bson:"status"`       // the status of the latest update
+	Message      string           `json:"message,omitempty" bson:"-"` // the message of the first update, only when creating
+	Pages        []bson.ObjectId  `json:"pages,omitempty" bson:"pages,omitempty"`
+	Project      bson.ObjectId    `json:"project,omitempty" bson:"project,omitempty"`
+	Auto         bool             `json:"auto" bson:"auto"`
+	Linked       []bson.ObjectId  `json:"linked,omitempty" bson:"linked,omitempty"`
+	Updates      []IncidentUpdate `json:"updates" bson:"updates"`
+	ResolvedAt   *time.Time       `json:"resolved_at,omitempty" bson:"resolved_at,omitempty"`
+	Public       bool             `json:"public" bson:"public"` // shown on the status page even when none of its pages is
+	CreatedBy    string           `json:"created_by,omitempty" bson:"created_by,omitempty"`
+}
+type SingleIncident struct {
+	Data Incident `json:"data"`
+}
+
+// IncidentUpdate is one entry of the incident timeline
+type IncidentUpdate struct {
+	Status  string    `json:"status" bson:"status"`
+	Message string    `json:"message" bson:"message"`
+	Time    time.Time `json:"time" bson:"time"`
+	Author  string    `json:"author,omitempty" bson:"author,omitempty"`
+}
+type SingleIncidentUpdate struct {
+	Data IncidentUpdate `json:"data"`
+}
+
+// Resolved tells if the incident is over
+func (i *Incident) Resolved() bool {
+	return i.Status == IncidentResolved
+}
+
+// IncidentFilter limits the list of the incidents: Status is "open", "resolved" or one of the incident states
+type IncidentFilter struct {
+	Status string
+	Page   bson.ObjectId
+	Auto   *bool
+	Since  time.Time // the incidents open at that time or later
+	Limit  int
+}
+
+func (f IncidentFilter) query() bson.M {
+	q := bson.M{}
+
+	switch f.Status {
+	case "":
+	case "open":
+		q["status"] = bson.M{"$ne": IncidentResolved}
+	default:
+		q["status"] = f.Status
+	}
+	if f.Page != "" {
+		q["pages"] = f.Page
+	}
+	if f.Auto != nil {
+		q["auto"] = *f.Auto
+	}
+	if !f.Since.IsZero() {
+		q["$or"] = []bson.M{
+			{"resolved_at": bson.M{"$exists": false}},
+			{"resolved_at": bson.M{"$gte": f.Since}},
+		}
+	}
+
+	return q
+}
+
+func (r *IncidentRepository) Incidents(f IncidentFilter) (incidents []*Incident, err error) {
+	q := r.collection().Find(scope(f.query(), "project", r.Projects)).Sort("-_created")
+	if f.Limit > 0 {
+		q = q.Limit(f.Limit)
+	}
+	err = q.All(&incidents)
+
+	return incidents, dbError(err, "Incident")
+}
+
+func (r *IncidentRepository) Find(id string) (*Incident, error) {
+	oid, err := objectId(id, "Incident")
+	if err != nil {
+		return nil, err
+	}
+
+	incident := &Incident{}
+	err = r.collection().Find(scope(bson.M{"_id": oid}, "project", r.Projects)).One(incident)
+	if err != nil {
+		return nil, dbError(err, "Incident")
+	}
+
+	return incident, nil
+}
+
+// Create posts the manual incident, its Message becomes the first update of the timeline
+func (r *IncidentRepository) Create(incident *Incident) error {
+	if incident.Title == "" {
+		return invalid("Incident cannot be created without the title")
+	}
+	if incident.Severity == "" {
+		incident.Severity = SeverityMinor
+	}
+	if incident.Severity != SeverityMinor && incident.Severity != SeverityMajor && incident.Severity != SeverityCritical {
+		return invalid("Incident severity must be " + SeverityMinor + ", " + SeverityMajor + " or " + SeverityCritical)
+	}
+	if incident.Status == "" {
+		incident.Status = IncidentInvestigating
+	}
+	if !validIncidentStatus(incident.Status) {
+		return invalid("Incident status must be " + IncidentInvestigating + ", " + IncidentIdentified + ", " + IncidentMonitoring + " or " + IncidentResolved)
+	}
+	if !inProjects(incident.Project, r.Projects) {
+		return invalid("Incident must belong to one of your projects")
+	}
+
+	// the affected pages and the linked incidents have to be visible to the author
+	if len(incident.Pages) > 0 {
+		n, err := r.Session.DB("").C(pageCollection).Find(scope(bson.M{"_id": bson.M{"$in": incident.Pages}}, "project", r.Projects)).Count()
+		if err != nil {
+			return dbError(err, "Page")
+		}
+		if n != len(incident.Pages) {
+			return invalid("Incident pages must exist and belong to your projects")
+		}
+	}
+	if len(incident.Linked) > 0 {
+		n, err := r.collection().Find(scope(bson.M{"_id": bson.M{"$in": incident.Linked}, "auto": true}, "project", r.Projects)).Count()
+		if err != nil {
+			return dbError(err, "Incident")
+		}
+		if n != len(incident.Linked) {
+			return invalid("Linked incidents must be the existing auto-detected ones")
+		}
+	}
+
+	incident.Id = bson.NewObjectId()
+	incident.Auto = false
+	incident.Updates = []IncidentUpdate{{Status: incident.Status, Message: incident.Message, Time: incident.Created, Author: incident.CreatedBy}}
+	if incident.Resolved() {
+		incident.ResolvedAt = &incident.Created
+	}
+
+	return dbError(r.collection().Insert(incident), "Incident")
+}
+
+// AddUpdate appends the update to the timeline of the incident and moves the incident to the state of the update
+func (r *IncidentRepository) AddUpdate(id string, update IncidentUpdate) (*Incident, error) {
+	if !validIncidentStatus(update.Status) {
+		return nil, invalid("Incident status must be " + IncidentInvestigating + ", " + IncidentIdentified + ", " + IncidentMonitoring + " or " + IncidentResolved)
+	}
+	if update.Message == "" {
+		return nil, invalid("Incident update cannot be created without the message")
+	}
+
+	incident, err := r.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{"status": update.Status, "_modified": update.Time}
+	if update.Status == IncidentResolved {
+		set["resolved_at"] = update.Time
+	}
+
+	err = r.collection().UpdateId(incident.Id, bson.M{"$set": set, "$push": bson.M{"updates": update}})
+	if err != nil {
+		return nil, dbError(err, "Incident")
+	}
+
+	return r.Find(id)
+}
+
+// OpenAuto opens the auto-detected incident of the page which went down, unless it's already open
+func (r *IncidentRepository) OpenAuto(page *Page, code int) error {
+	n, err := r.collection().Find(bson.M{"auto": true, "pages": page.Id, "status": bson.M{"$ne": IncidentResolved}}).Count()
+	if err != nil || n > 0 {
+		return dbError(err, "Incident")
+	}
+
+	now := time.Now()
+	incident := &Incident{
+		Title:    page.Name + " is down",
+		Severity: SeverityMajor,
+		Status:   IncidentInvestigating,
+		Pages:    []bson.ObjectId{page.Id},
+		Project:  page.Project,
+		Auto:     true,
+		Updates:  []IncidentUpdate{{Status: IncidentInvestigating, Message: "The check returned " + strconv.Itoa(code), Time: now}},
+	}
+	incident.Id = bson.NewObjectId()
+	incident.SetInsertDefaults(now)
+
+	return dbError(r.collection().Insert(incident), "Incident")
+}
+
+// ResolveAuto resolves the open auto-detected incidents of the page which is back up
+func (r *IncidentRepository) ResolveAuto(page *Page) error {
+	now := time.Now()
+	update := IncidentUpdate{Status: IncidentResolved, Message: "The check passes again", Time: now}
+
+	_, err := r.collection().UpdateAll(
+		bson.M{"auto": true, "pages": page.Id, "status": bson.M{"$ne": IncidentResolved}},
+		bson.M{"$set": bson.M{"status": IncidentResolved, "resolved_at": now, "_modified": now}, "$push": bson.M{"updates": update}},
+	)
+
+	return dbError(err, "Incident")
+}
+
+func validIncidentStatus(s string) bool {
+	return s == IncidentInvestigating || s == IncidentIdentified || s == IncidentMonitoring || s == IncidentResolved
+}
+
+// unexported methods
+func (repo *IncidentRepository) collection() *mgo.Collection {
+	return repo.Session.DB("").C(incidentCollection)
+}
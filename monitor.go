@@ -0,0 +1,294 @@
+package ping
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+	"sigs.k8s.io/yaml"
+)
+
+// Monitor is the definition of a page: its check, assertions and notification routing, without the runtime state
+// (last status, next ping, content...). Monitors are exported/imported as YAML or JSON and matched with the pages
+// by the Slug or, if there is no slug, by the Url
+type Monitor struct {
+	Slug          string             `json:"slug,omitempty"`
+	Name          string             `json:"name"`
+	Description   string             `json:"description,omitempty"`
+	Url           string             `json:"url"`
+	RescueUrl     string             `json:"rescue_url,omitempty"`
+	Interval      int                `json:"interval"`
+	DesiredStatus int                `json:"desiredstatus,omitempty"`
+	Disabled      bool               `json:"disabled,omitempty"`
+	Type          string             `json:"type,omitempty"`
+	GRPC          *GRPCCheck         `json:"grpc,omitempty"`
+	Steps         []Step             `json:"steps,omitempty"`
+	StatusPage    *StatusPageCheck   `json:"statuspage,omitempty"`
+	ContentCheck  *ContentCheck      `json:"content_check,omitempty"`
+	Latency       []LatencyAssertion `json:"latency,omitempty"`
+	Project       bson.ObjectId      `json:"project,omitempty"`
+	ContactGroups []bson.ObjectId    `json:"contact_groups,omitempty"`
+	Tags          []string           `json:"tags,omitempty"`
+	Group         string             `json:"group,omitempty"`
+	Locations     []string           `json:"locations,omitempty"`
+	Quorum        int                `json:"quorum,omitempty"`
+}
+
+// MonitorFile is the content of the exported/imported file
+type MonitorFile struct {
+	Monitors []Monitor `json:"monitors"`
+}
+
+// ParseMonitors reads the monitors from YAML or JSON (JSON is a subset of YAML)
+func ParseMonitors(data []byte) ([]Monitor, error) {
+	f := MonitorFile{}
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+
+	return f.Monitors, nil
+}
+
+// MonitorFromPage takes the definition out of the page
+func MonitorFromPage(p *Page) Monitor {
+	return Monitor{
+		Slug:          p.Slug,
+		Name:          p.Name,
+		Description:   p.Description,
+		Url:           p.Url,
+		RescueUrl:     p.RescueUrl,
+		Interval:      p.Interval,
+		DesiredStatus: p.DesiredStatus,
+		Disabled:      p.Disabled,
+		Type:          p.Type,
+		GRPC:          p.GRPC,
+		Steps:         p.Steps,
+		StatusPage:    p.StatusPage,
+		ContentCheck:  p.ContentCheck,
+		Latency:       p.Latency,
+		Project:       p.Project,
+		ContactGroups: p.ContactGroups,
+		Tags:          p.Tags,
+		Group:         p.Group,
+		Locations:     p.Locations,
+		Quorum:        p.Quorum,
+	}
+}
+
+// ApplyTo sets the definition on the page, the runtime state of the page stays as it is
+func (m Monitor) ApplyTo(p *Page) {
+	p.Slug = m.Slug
+	p.Name = m.Name
+	p.Description = m.Description
+	p.Url = m.Url
+	p.RescueUrl = m.RescueUrl
+	p.Interval = m.Interval
+	p.DesiredStatus = m.DesiredStatus
+	p.Disabled = m.Disabled
+	p.Type = m.Type
+	p.GRPC = m.GRPC
+	p.Steps = m.Steps
+	p.StatusPage = m.StatusPage
+	p.ContentCheck = m.ContentCheck
+	p.Latency = m.Latency
+	p.Project = m.Project
+	p.ContactGroups = m.ContactGroups
+	p.Tags = m.Tags
+	p.Group = m.Group
+	p.Locations = m.Locations
+	p.Quorum = m.Quorum
+}
+
+func (m Monitor) key() string {
+	if m.Slug != "" {
+		return "slug:" + m.Slug
+	}
+
+	return "url:" + m.Url
+}
+
+// Plan lists what has to be done to make the pages match the monitors
+type Plan struct {
+	Create []Monitor    `json:"create"`
+	Update []PlanUpdate `json:"update"`
+	Delete []PlanDelete `json:"delete"`
+}
+
+// PlanUpdate is an existing page which definition differs from the monitor
+type PlanUpdate struct {
+	Page    bson.ObjectId     `json:"page"`
+	Monitor Monitor           `json:"monitor"`
+	Changes map[string]Change `json:"changes"`
+}
+
+// PlanDelete is an existing page which is not among the monitors
+type PlanDelete struct {
+	Page bson.ObjectId `json:"page"`
+	Name string        `json:"name"`
+	Url  string        `json:"url"`
+}
+
+// Empty tells if there is nothing to do
+func (p *Plan) Empty() bool {
+	return len(p.Create) == 0 && len(p.Update) == 0 && len(p.Delete) == 0
+}
+
+// NewPlan compares the existing pages with the monitors. The pages which are not among the monitors are deleted
+// only with prune. The pages which already match their monitors are left alone, so applying the same file twice
+// doesn't change anything. The pages to create and update are validated (and checked to be in the projects, nil
+// means all of them) up front, as the Apply stops at the first failure with the previous changes already made
+func NewPlan(existing []*Page, monitors []Monitor, prune bool, projects []bson.ObjectId) (*Plan, error) {
+	plan := &Plan{Create: []Monitor{}, Update: []PlanUpdate{}, Delete: []PlanDelete{}}
+
+	bySlug := map[string]*Page{}
+	byUrl := map[string]*Page{} // by the url in the project, so the page of another project is never matched
+	taken := map[string]bool{}  // the url in the project, there can be only one such page
+	for _, p := range existing {
+		if p.Slug != "" {
+			bySlug[p.Slug] = p
+		}
+		byUrl[projectUrl(p.Project, p.Url)] = p
+		taken[projectUrl(p.Project, p.Url)] = true
+	}
+
+	seen := map[string]bool{}
+	matched := map[bson.ObjectId]bool{}
+	v := &validator{}
+
+	for i, m := range monitors {
+		if m.Url == "" {
+			return nil, invalid("Monitor " + m.Name + " has no url")
+		}
+		// the same defaults as in the PageRepository.Create, otherwise they would be a change every time
+		if m.Name == "" {
+			m.Name = m.Url
+		}
+		if m.Description == "" {
+			m.Description = m.Name
+		}
+		if seen[m.key()] {
+			return nil, invalid("Monitor " + m.key() + " is defined more than once")
+		}
+		seen[m.key()] = true
+
+		page := bySlug[m.Slug]
+		if page == nil {
+			// by the url; the page without the slug (eg. created before the slugs) gets the slug of the monitor
+			if p := byUrl[projectUrl(m.Project, m.Url)]; p != nil && (m.Slug == "" || p.Slug == "") && !matched[p.Id] {
+				page = p
+			}
+		}
+
+		after := &Page{}
+		if page != nil {
+			*after = *page
+		}
+		m.ApplyTo(after)
+		v.monitor("monitors/"+strconv.Itoa(i), m.key(), after, projects)
+
+		if page == nil {
+			if taken[projectUrl(after.Project, after.Url)] {
+				v.add("monitors/"+strconv.Itoa(i)+"/url", m.key()+": Page with the url "+m.Url+" already exist")
+			}
+			taken[projectUrl(after.Project, after.Url)] = true
+
+			plan.Create = append(plan.Create, m)
+			continue
+		}
+		matched[page.Id] = true
+
+		changes, err := diff(MonitorFromPage(page), m)
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) > 0 {
+			plan.Update = append(plan.Update, PlanUpdate{Page: page.Id, Monitor: m, Changes: changes})
+		}
+	}
+
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	if prune {
+		for _, p := range existing {
+			if !matched[p.Id] {
+				plan.Delete = append(plan.Delete, PlanDelete{Page: p.Id, Name: p.Name, Url: p.Url})
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// projectUrl is the key of the url in the project
+func projectUrl(project bson.ObjectId, url string) string {
+	return project.Hex() + " " + url
+}
+
+// monitor adds the problems of the page made from the monitor, under the field of the monitor
+func (v *validator) monitor(field, key string, page *Page, projects []bson.ObjectId) {
+	var ve *ValidationError
+	if err := page.Validate(); errors.As(err, &ve) {
+		for _, f := range ve.Fields {
+			v.add(field+"/"+f.Field, key+": "+f.Msg)
+		}
+	}
+
+	if !inProjects(page.Project, projects) {
+		v.add(field+"/project", key+": Page must belong to one of your projects")
+	}
+}
+
+// Apply makes the planned changes as the actor. The optional audit func is called after each change
+func (p *Plan) Apply(repo IPageRepository, actor string, audit func(action string, before, after *Page)) error {
+	if audit == nil {
+		audit = func(string, *Page, *Page) {}
+	}
+
+	for _, m := range p.Create {
+		page := &Page{}
+		m.ApplyTo(page)
+		page.SetInsertDefaults(time.Now())
+		page.CreatedBy = actor
+		page.ModifiedBy = actor
+
+		if err := repo.Create(page); err != nil {
+			return fmt.Errorf("%s: %w", m.key(), err)
+		}
+		audit(ActionCreate, nil, page)
+	}
+
+	for _, u := range p.Update {
+		before, err := repo.Find(u.Page.Hex())
+		if err != nil {
+			return fmt.Errorf("%s: %w", u.Monitor.key(), err)
+		}
+
+		page := before.Data
+		u.Monitor.ApplyTo(&page)
+		page.SetUpdateDefaults(time.Now())
+		page.ModifiedBy = actor
+
+		if err = repo.Update(&page); err != nil {
+			return fmt.Errorf("%s: %w", u.Monitor.key(), err)
+		}
+		audit(ActionUpdate, &before.Data, &page)
+	}
+
+	for _, d := range p.Delete {
+		before, err := repo.Find(d.Page.Hex())
+		if err != nil {
+			return fmt.Errorf("%s: %w", d.Url, err)
+		}
+
+		if err = repo.Delete(d.Page.Hex()); err != nil {
+			return fmt.Errorf("%s: %w", d.Url, err)
+		}
+		audit(ActionDelete, &before.Data, nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package ping
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestNewPlanMatchesUrlInProject(t *testing.T) {
+	mine, theirs := bson.NewObjectId(), bson.NewObjectId()
+	page := &Page{Name: "Home", Description: "Home", Url: "https://example.com/", Interval: 5, Project: theirs}
+	page.Id = bson.NewObjectId()
+
+	tests := []struct {
+		name    string
+		project bson.ObjectId
+		creates int
+		updates int
+	}{
+		{"same project", theirs, 0, 1},
+		{"other project", mine, 1, 0},
+		{"no project", "", 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitors := []Monitor{{Slug: "home", Name: "Home", Url: page.Url, Interval: 5, Project: tt.project}}
+
+			plan, err := NewPlan([]*Page{page}, monitors, false, nil)
+			if err != nil {
+				t.Fatalf("NewPlan() error = %v", err)
+			}
+			if len(plan.Create) != tt.creates || len(plan.Update) != tt.updates {
+				t.Errorf("NewPlan() creates %d and updates %d, want %d and %d", len(plan.Create), len(plan.Update), tt.creates, tt.updates)
+			}
+		})
+	}
+}
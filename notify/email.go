@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/tomekwlod/ping"
+)
+
+// Email sends the messages through the smtp server of the parameters.yml, to the emails of the message
+// or to the default To
+type Email struct {
+	Server string
+	Port   string
+	From   string
+	To     []string
+}
+
+// NewEmail takes the smtp settings from the parameters.yml (see ping.LoadConfig)
+func NewEmail() (*Email, error) {
+	cnf, err := ping.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if cnf.SMTP_Email == "" || cnf.SMTP_Server == "" || cnf.SMTP_Port == "" {
+		return nil, errors.New("SMTP credentials not set")
+	}
+
+	return &Email{Server: cnf.SMTP_Server, Port: cnf.SMTP_Port, From: cnf.SMTP_Email, To: cnf.SMTP_Emails}, nil
+}
+
+func (e *Email) Notify(m Message) error {
+	to := m.Emails
+	if len(to) == 0 {
+		to = e.To
+	}
+	if len(to) == 0 {
+		return nil
+	}
+
+	// Setup headers
+	headers := [][2]string{
+		{"From", e.From},
+		{"To", strings.Join(to, ",")},
+		{"Subject", m.Subject},
+	}
+
+	// Setup message
+	message := ""
+	for _, h := range headers {
+		message += fmt.Sprintf("%s: %s\r\n", h[0], h[1])
+	}
+	message += "\r\n" + m.Text
+
+	// Connect to the SMTP Server
+	c, err := smtp.Dial(e.Server + ":" + e.Port)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// To && From
+	if err = c.Mail(e.From); err != nil {
+		return err
+	}
+	for _, email := range to {
+		if err = c.Rcpt(email); err != nil {
+			return err
+		}
+	}
+
+	// Data
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write([]byte(message)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/tomekwlod/ping"
+)
+
+// Message is what the notifiers send. Without the recipients the notifiers use their defaults
+// (TELEGRAM_CHATID, the smtp_emails of the parameters.yml)
+type Message struct {
+	Subject string
+	Text    string
+	ChatIDs []string
+	Emails  []string
+}
+
+// Notifier sends the message to one channel (telegram, email...)
+type Notifier interface {
+	Notify(Message) error
+}
+
+// FromEnv returns the notifiers listed in PING_NOTIFY (comma separated, "telegram" by default).
+// A notifier which is listed but not configured is an error
+func FromEnv() ([]Notifier, error) {
+	names := os.Getenv("PING_NOTIFY")
+	if names == "" {
+		names = "telegram"
+	}
+
+	notifiers := []Notifier{}
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "telegram":
+			t, err := NewTelegram(os.Getenv("TELEGRAM_TOKEN"), os.Getenv("TELEGRAM_CHATID"))
+			if err != nil {
+				return nil, err
+			}
+			notifiers = append(notifiers, t)
+		case "email":
+			e, err := NewEmail()
+			if err != nil {
+				return nil, err
+			}
+			notifiers = append(notifiers, e)
+		default:
+			return nil, errors.New("Unknown notifier " + name)
+		}
+	}
+
+	return notifiers, nil
+}
+
+// Broadcast sends the message with all the notifiers. A failing notifier doesn't stop the others,
+// the first error is returned
+func Broadcast(notifiers []Notifier, m Message) (err error) {
+	for _, n := range notifiers {
+		if e := n.Notify(m); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return
+}
+
+// Recipients are the telegram chats and the emails of the contact groups
+func Recipients(groups []*ping.ContactGroup) (chats, emails []string) {
+	for _, g := range groups {
+		if g.TelegramChatID != "" {
+			chats = append(chats, g.TelegramChatID)
+		}
+		emails = append(emails, g.Emails...)
+	}
+
+	return
+}
@@ -0,0 +1,40 @@
+package notify
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Telegram sends the messages with the bot to the chats of the message or to the default ChatID
+type Telegram struct {
+	Bot    *tgbotapi.BotAPI
+	ChatID string
+}
+
+func NewTelegram(token, chatID string) (*Telegram, error) {
+	bot, err := tgbotapi.NewBotAPI(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Telegram{Bot: bot, ChatID: chatID}, nil
+}
+
+func (t *Telegram) Notify(m Message) error {
+	chats := m.ChatIDs
+	if len(chats) == 0 {
+		chats = []string{t.ChatID}
+	}
+
+	text := m.Text
+	if m.Subject != "" {
+		text = m.Subject + "\n\n" + m.Text
+	}
+
+	for _, chat := range chats {
+		if _, err := t.Bot.Send(tgbotapi.NewMessageToChannel(chat, text)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
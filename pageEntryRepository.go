@@ -1,6 +1,8 @@
 package ping
 
 import (
+	"time"
+
 	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -11,6 +13,8 @@ const (
 
 type IPageEntryRepository interface {
 	Create(*PageEntry) error
+	History(pageID string, limit int) ([]*PageEntry, error)
+	DailyUptime(pageIDs []bson.ObjectId, since time.Time) (map[bson.ObjectId]map[string]DayUptime, error)
 	Close()
 }
 
@@ -26,8 +30,44 @@ type PageEntry struct {
 	DocumentBase `bson:",inline"`
 	Load         float64       `json:"load"`
 	Code         int           `json:"code"`
+	Up           bool          `json:"up" bson:"up"` // the code was the desired one of the page
 	Page         bson.ObjectId `json:"page" bson:"page"`
+	Probe        string        `json:"probe,omitempty" bson:"probe,omitempty"` // the location which made the check
+	Steps        []StepResult  `json:"steps,omitempty" bson:"steps,omitempty"`
+	Timing       *Timing       `json:"timing,omitempty" bson:"timing,omitempty"`
+}
+
+// Timing is the breakdown of the http check duration (in seconds), it tells if the slowness is the network or the app
+type Timing struct {
+	DNS      float64 `json:"dns" bson:"dns"`
+	Connect  float64 `json:"connect" bson:"connect"`
+	TLS      float64 `json:"tls" bson:"tls"`
+	TTFB     float64 `json:"ttfb" bson:"ttfb"` // time to first byte, counted from the start of the request
+	Transfer float64 `json:"transfer" bson:"transfer"`
 }
+
+// Phase returns the duration of the named phase; total is the whole check (the PageEntry Load)
+func (t *Timing) Phase(name string) (float64, bool) {
+	switch name {
+	case "dns":
+		return t.DNS, true
+	case "connect":
+		return t.Connect, true
+	case "tls":
+		return t.TLS, true
+	case "ttfb":
+		return t.TTFB, true
+	case "transfer":
+		return t.Transfer, true
+	}
+
+	return 0, false
+}
+
+// entryUp is the condition of the successful entry; the entries made before the up was stored were successful
+// only with the 200
+var entryUp = bson.M{"$ifNull": []interface{}{"$up", bson.M{"$eq": []interface{}{"$code", 200}}}}
+
 type PageEntryCollection struct {
 	Data []Page `json:"data"`
 }
@@ -38,27 +78,80 @@ func (repo *PageEntryRepository) collection() *mgo.Collection {
 }
 
 func (r *PageEntryRepository) Create(pageEntry *PageEntry) error {
-	// result := SinglePage{}
-	// _ = r.collection().Find(bson.M{"url": page.Url}).One(&result.Data)
+	if pageEntry.Page == "" {
+		return invalid("Page entry cannot be created without the page")
+	}
 
-	// if result.Data.Id != "" {
-	// 	return errors.New("Page already exist")
-	// }
+	pageEntry.Id = bson.NewObjectId()
 
-	// id := bson.NewObjectId()
+	return dbError(r.collection().Insert(pageEntry), "Page entry")
+}
+
+// History returns the latest entries of the page, the newest first
+func (r *PageEntryRepository) History(pageID string, limit int) (entries []*PageEntry, err error) {
+	page, err := objectId(pageID, "Page")
+	if err != nil {
+		return nil, err
+	}
 
-	// if page.Url == "" {
-	// 	return errors.New("Page cannot be created without the URL value")
-	// }
+	err = r.collection().Find(bson.M{"page": page}).Sort("-_id").Limit(limit).All(&entries)
 
-	// _, err := r.collection().UpsertId(id, page)
-	// if err != nil {
-	// 	return err
-	// }
+	return entries, dbError(err, "Page entry")
+}
 
-	// page.Id = id
+// DayUptime is the number of all and the successful checks of a page during one day
+type DayUptime struct {
+	Day    string `json:"day" bson:"day"` // YYYY-MM-DD (UTC)
+	Checks int    `json:"checks" bson:"checks"`
+	Up     int    `json:"up" bson:"up"`
+}
+
+// Percent is the uptime of the day
+func (d DayUptime) Percent() float64 {
+	if d.Checks == 0 {
+		return 0
+	}
+
+	return 100 * float64(d.Up) / float64(d.Checks)
+}
 
-	return nil
+// DailyUptime counts the checks of the pages day by day since the given time. The result is indexed by the page id
+// and the day (YYYY-MM-DD); the days without any checks are missing
+func (r *PageEntryRepository) DailyUptime(pageIDs []bson.ObjectId, since time.Time) (map[bson.ObjectId]map[string]DayUptime, error) {
+	var rows []struct {
+		Id struct {
+			Page bson.ObjectId `bson:"page"`
+			Day  string        `bson:"day"`
+		} `bson:"_id"`
+		Checks int `bson:"checks"`
+		Up     int `bson:"up"`
+	}
+
+	err := r.collection().Pipe([]bson.M{
+		{"$match": bson.M{"page": bson.M{"$in": pageIDs}, "_created": bson.M{"$gte": since}}},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"page": "$page",
+				"day":  bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$_created"}},
+			},
+			"checks": bson.M{"$sum": 1},
+			"up":     bson.M{"$sum": bson.M{"$cond": []interface{}{entryUp, 1, 0}}},
+		}},
+	}).All(&rows)
+	if err != nil {
+		return nil, dbError(err, "Page entry")
+	}
+
+	result := map[bson.ObjectId]map[string]DayUptime{}
+	for _, row := range rows {
+		if result[row.Id.Page] == nil {
+			result[row.Id.Page] = map[string]DayUptime{}
+		}
+
+		result[row.Id.Page][row.Id.Day] = DayUptime{Day: row.Id.Day, Checks: row.Checks, Up: row.Up}
+	}
+
+	return result, nil
 }
 
 // func (repo *PageEntryRepository) GetAll(page *Page) (entries []*PageEntry, err error) {
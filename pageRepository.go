@@ -1,7 +1,10 @@
 package ping
 
 import (
-	"errors"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/mgo.v2"
@@ -12,51 +15,102 @@ const (
 	pageCollection = "pages"
 )
 
+// Check types supported by the checker. An empty type means CheckHTTP
+const (
+	CheckHTTP       = "http"
+	CheckGRPC       = "grpc"
+	CheckScenario   = "scenario"
+	CheckStatusPage = "statuspage"
+)
+
+// ErrPageChanged is returned when the version of the page to save is not the current one
+var ErrPageChanged = &Error{Kind: ErrStale, Msg: "Page was changed in the meantime, load it again"}
+
 // IPageRepository exposes the methods for the PageRepository
 // The methods are obviously the PageRepository methods, and to use the PageRepository you need to pass the *mgo.Session to it
 // I know shouldn't be using IName but in this case I have a name collision; need to resolve it later
 type IPageRepository interface {
-	Pages() ([]*Page, error)
-	PagesForPing() ([]*Page, error)
+	Pages(PageFilter) (pages []*Page, total int, err error)
+	PagesForPing(probe string) ([]*Page, error)
 	Find(ID string) (*SinglePage, error)
 	Delete(ID string) error
+	Restore(ID string) error
+	Purge(deletedBefore time.Time) (int, error)
 	Create(*Page) error
 	Update(*Page) error
-	Upsert(*Page) error
+	Patch(page *Page, set, unset bson.M) error
+	SaveCheck(page *Page, probe string, state ProbeState) (*Page, error)
+	SetStatus(ID bson.ObjectId, from, to int) (bool, error)
+	SetContent(ID bson.ObjectId, from, hash, snapshot string) (bool, error)
+	CheckNow(page *Page, now time.Time) error
 	Close()
 }
 
+// PageRepository works only with the pages of the given Projects; nil means all of them (admins, the checker)
 type PageRepository struct {
-	Session *mgo.Session
+	Session  *mgo.Session
+	Projects []bson.ObjectId
 }
 
 func (repo *PageRepository) Close() {
 	repo.Session.Close()
 }
 
-func (r *PageRepository) Pages() (pages []*Page, err error) {
-	// Find normally takes a query, but as we want everything, we can nil this.
-	// We then bind our consignments variable by passing it as an argument to .All().
-	// That sets consignments to the result of the find query.
+// Pages returns a page (Limit, Offset) of the pages matching the filter and the total number of the matching pages.
+// The (potentially big) content fields are skipped unless they are asked for in the filter Fields
+func (r *PageRepository) Pages(filter PageFilter) (pages []*Page, total int, err error) {
+	q := r.collection().Find(r.scope(filter.query()))
+
+	total, err = q.Count()
+	if err != nil {
+		return nil, 0, dbError(err, "Page")
+	}
+
+	sort := "-_id"
+	if s, ok := pageSorts[strings.TrimPrefix(filter.Sort, "-")]; ok {
+		sort = s
+		if strings.HasPrefix(filter.Sort, "-") {
+			sort = "-" + s
+		}
+	}
+
+	// We bind our pages variable by passing it as an argument to .All().
+	// That sets pages to the result of the find query.
 	// There's also a `One()` function for single results.
-	err = r.collection().Find(nil).All(&pages)
+	err = q.Sort(sort).Skip(filter.Offset).Limit(filter.Limit).Select(filter.selection()).All(&pages)
 
-	return
+	return pages, total, dbError(err, "Page")
 }
 
-func (r *PageRepository) PagesForPing() (pages []*Page, err error) {
-	err = r.collection().Find(bson.M{"$or": []bson.M{
-		bson.M{"nextPing": bson.M{"$lte": time.Now()}},
-		bson.M{"nextPing": bson.M{"$exists": false}},
-	}}).Sort("-_id").All(&pages)
-
-	return
+// PagesForPing returns the pages due for the check by the probe: the pages of its location (or of all the locations)
+// which the probe hasn't checked yet or which next ping of the probe has come
+func (r *PageRepository) PagesForPing(probe string) (pages []*Page, err error) {
+	now := time.Now()
+	state := "probes." + probe
+
+	err = r.collection().Find(r.scope(bson.M{"$and": []bson.M{
+		{"$or": []bson.M{
+			{state + ".nextPing": bson.M{"$lte": now}},
+			// never checked by the probe (eg. a new page or a new probe): the page level nextPing
+			{state: bson.M{"$exists": false}, "$or": []bson.M{
+				{"nextPing": bson.M{"$lte": now}},
+				{"nextPing": bson.M{"$exists": false}},
+			}},
+		}},
+		{"$or": []bson.M{
+			{"locations": bson.M{"$exists": false}},
+			{"locations": bson.M{"$size": 0}},
+			{"locations": probe},
+		}},
+	}, "deleted_at": bson.M{"$exists": false}, "disabled": bson.M{"$ne": true}})).Sort("-_id").All(&pages)
+
+	return pages, dbError(err, "Page")
 }
 
 ////old
 func (r *PageRepository) AllPages() (PageCollection, error) {
 	result := PageCollection{[]*Page{}}
-	err := r.collection().Find(bson.M{}).Select(bson.M{"content": 0}).All(&result.Data)
+	err := r.collection().Find(r.scope(bson.M{"deleted_at": bson.M{"$exists": false}})).Select(bson.M{"content": 0}).All(&result.Data)
 
 	if err != nil {
 		return result, err
@@ -76,29 +130,39 @@ func (r *PageRepository) AllPages() (PageCollection, error) {
 // 	return result, nil
 // }
 
+// Find returns the page even if it's deleted (see the DeletedAt), so it can be looked at before it's restored
 func (r *PageRepository) Find(id string) (*SinglePage, error) {
+	oid, err := objectId(id, "Page")
+	if err != nil {
+		return nil, err
+	}
+
 	result := &SinglePage{}
-	err := r.collection().FindId(bson.ObjectIdHex(id)).One(&result.Data)
+	err = r.collection().Find(r.scope(bson.M{"_id": oid})).One(&result.Data)
 	if err != nil {
-		return result, err
+		return nil, dbError(err, "Page")
 	}
 
 	return result, nil
 }
 
 func (r *PageRepository) Create(page *Page) error {
-	result := SinglePage{}
-	_ = r.collection().Find(bson.M{"url": page.Url}).One(&result.Data)
-
-	if result.Data.Id != "" {
-		return errors.New("Page already exist")
+	if err := page.Validate(); err != nil {
+		return err
+	}
+	if !inProjects(page.Project, r.Projects) {
+		return invalid("Page must belong to one of your projects")
+	}
+	if err := r.checkContactGroups(page); err != nil {
+		return err
 	}
 
-	id := bson.NewObjectId()
+	// the new page starts with the clean state, whatever was sent; the same url in the project is refused by
+	// the unique index (see the EnsureIndexes)
+	page.clearState()
+	page.Id = bson.NewObjectId()
+	page.Version = 1
 
-	if page.Url == "" {
-		return errors.New("Page cannot be created without the URL value")
-	}
 	if page.Name == "" {
 		page.Name = page.Url
 	}
@@ -106,35 +170,244 @@ func (r *PageRepository) Create(page *Page) error {
 		page.Description = page.Name
 	}
 
-	_, err := r.collection().UpsertId(id, page)
+	err := r.collection().Insert(page)
 	if err != nil {
+		page.Id = ""
+		return dbError(err, "Page")
+	}
+
+	return nil
+}
+
+// EnsureIndexes creates the indexes the repository relies on: there can be only one page of the url in the project,
+// apart from the deleted ones (each one has its own deleted_at, the others have none)
+func (r *PageRepository) EnsureIndexes() error {
+	return dbError(r.collection().EnsureIndex(mgo.Index{
+		Key:    []string{"project", "url", "deleted_at"},
+		Unique: true,
+	}), "Page index")
+}
+
+func (r *PageRepository) Update(page *Page) error {
+	if err := page.Validate(); err != nil {
+		return err
+	}
+	if !inProjects(page.Project, r.Projects) {
+		return invalid("Page must belong to one of your projects")
+	}
+	if err := r.checkContactGroups(page); err != nil {
 		return err
 	}
 
-	page.Id = id
+	// only the definition is saved; the state of the checker (the probes, the content...) and the creation
+	// fields stay as they are in the db
+	set, unset := page.definition()
+	set["_modified"] = page.Modified
+	set["modified_by"] = page.ModifiedBy
+	change := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if len(unset) > 0 {
+		change["$unset"] = unset
+	}
+
+	err := r.collection().Update(r.scope(bson.M{"_id": page.Id, "deleted_at": bson.M{"$exists": false}, "version": versionQuery(page.Version)}), change)
+	if err != nil {
+		return r.updateError(err, page.Id)
+	}
+	page.Version++
 
 	return nil
 }
 
-func (r *PageRepository) Update(page *Page) (err error) {
-	err = r.collection().UpdateId(page.Id, page)
+// Patch saves only the fields (by their bson names, see the ApplyPatch) of the page, which is the page
+// with the fields already set; it's validated as a whole
+func (r *PageRepository) Patch(page *Page, set, unset bson.M) error {
+	if err := page.Validate(); err != nil {
+		return err
+	}
+	if !inProjects(page.Project, r.Projects) {
+		return invalid("Page must belong to one of your projects")
+	}
+	if err := r.checkContactGroups(page); err != nil {
+		return err
+	}
+
+	fields := bson.M{"_modified": page.Modified, "modified_by": page.ModifiedBy}
+	for k, v := range set {
+		fields[k] = v
+	}
+	change := bson.M{"$set": fields, "$inc": bson.M{"version": 1}}
+	if len(unset) > 0 {
+		change["$unset"] = unset
+	}
+
+	err := r.collection().Update(
+		r.scope(bson.M{"_id": page.Id, "deleted_at": bson.M{"$exists": false}, "version": versionQuery(page.Version)}),
+		change,
+	)
+	if err != nil {
+		return r.updateError(err, page.Id)
+	}
+	page.Version++
+
+	return nil
+}
+
+// SaveCheck saves the state of the page after its check by the probe and returns the saved page, with the states
+// of the other probes (the watched content is saved separately, see the SetContent). Only the fields of the checker are set, so the changes of the definition made during the run
+// stay; the page deleted in the meantime is not found (and not re-created). The status of the page is changed
+// separately (see the SetStatus), by the quorum of the probes
+func (r *PageRepository) SaveCheck(page *Page, probe string, state ProbeState) (*Page, error) {
+	set := bson.M{
+		"probes." + probe: state,
+		"checked":         page.Checked,
+		"lastload":        page.LastLoad,
+		"nextPing":        page.NextPing,
+		"content":         page.Content,
+	}
+	if page.TLSExpiry != nil {
+		set["tls_expiry"] = page.TLSExpiry
+	}
+
+	// the counters of the checks, so the metrics don't count the whole history
+	inc := bson.M{"checks": 1}
+	if page.Up(state.Code) {
+		inc["checks_up"] = 1
+	}
+
+	saved := &Page{}
+	_, err := r.collection().Find(r.scope(bson.M{"_id": page.Id, "deleted_at": bson.M{"$exists": false}})).
+		Apply(mgo.Change{Update: bson.M{"$set": set, "$inc": inc}, ReturnNew: true}, saved)
+	if err != nil {
+		return nil, dbError(err, "Page")
+	}
+
+	return saved, nil
+}
+
+// SetContent saves the hash (and the snapshot) of the watched content of the page, but only if the hash is still
+// the from one. With many probes only the one which saves the new content reports its change
+func (r *PageRepository) SetContent(id bson.ObjectId, from, hash, snapshot string) (bool, error) {
+	var current interface{} = from
+	if from == "" {
+		// the first content of the page, there is no hash yet
+		current = bson.M{"$in": []interface{}{"", nil}}
+	}
+
+	err := r.collection().Update(
+		r.scope(bson.M{"_id": id, "deleted_at": bson.M{"$exists": false}, "content_hash": current}),
+		bson.M{"$set": bson.M{"content_hash": hash, "content_snapshot": snapshot}},
+	)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, dbError(err, "Page")
+	}
+
+	return true, nil
+}
+
+// CheckNow makes the page due, so it's checked by the next run of the checker (of every probe) regardless
+// of its interval
+func (r *PageRepository) CheckNow(page *Page, now time.Time) error {
+	set := bson.M{"nextPing": now}
+	for name := range page.Probes {
+		set["probes."+name+".nextPing"] = now
+	}
+
+	err := r.collection().Update(r.scope(bson.M{"_id": page.Id, "deleted_at": bson.M{"$exists": false}}), bson.M{"$set": set})
+	if err != nil {
+		return dbError(err, "Page")
+	}
 
 	return nil
 }
 
-func (r *PageRepository) Upsert(page *Page) (err error) {
-	_, err = r.collection().UpsertId(page.Id, page)
+// SetStatus changes the last status of the page, but only if it's still the from status. With many probes only one
+// of them makes the change (and sends the alerts)
+func (r *PageRepository) SetStatus(id bson.ObjectId, from, to int) (bool, error) {
+	err := r.collection().Update(r.scope(bson.M{"_id": id, "laststatus": from}), bson.M{"$set": bson.M{"laststatus": to}})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, dbError(err, "Page")
+	}
 
-	return
+	return true, nil
 }
 
+// Delete only marks the page as deleted; it disappears from the lists and it's not checked anymore,
+// but it can be restored until it's purged
 func (r *PageRepository) Delete(id string) error {
-	err := r.collection().RemoveId(bson.ObjectIdHex(id))
+	oid, err := objectId(id, "Page")
 	if err != nil {
 		return err
 	}
 
-	return nil
+	err = r.collection().Update(
+		r.scope(bson.M{"_id": oid, "deleted_at": bson.M{"$exists": false}}),
+		bson.M{"$set": bson.M{"deleted_at": time.Now()}},
+	)
+
+	return dbError(err, "Page")
+}
+
+// Restore brings back the deleted page
+func (r *PageRepository) Restore(id string) error {
+	oid, err := objectId(id, "Page")
+	if err != nil {
+		return err
+	}
+
+	err = r.collection().Update(
+		r.scope(bson.M{"_id": oid, "deleted_at": bson.M{"$exists": true}}),
+		bson.M{"$unset": bson.M{"deleted_at": ""}, "$set": bson.M{"_modified": time.Now()}},
+	)
+	if mgo.IsDup(err) {
+		// the url was taken in the meantime (see the EnsureIndexes)
+		return &Error{Kind: ErrDuplicate, Msg: "Page with the same url already exist in the project", Err: err}
+	}
+
+	return dbError(err, "Deleted page")
+}
+
+// Purge removes for good the pages deleted before the given time, together with their history.
+// It returns the number of the removed pages
+func (r *PageRepository) Purge(deletedBefore time.Time) (int, error) {
+	var pages []*Page
+	err := r.collection().Find(r.scope(bson.M{"deleted_at": bson.M{"$lt": deletedBefore}})).Select(bson.M{"_id": 1}).All(&pages)
+	if err != nil || len(pages) == 0 {
+		return 0, dbError(err, "Page")
+	}
+
+	ids := []bson.ObjectId{}
+	for _, p := range pages {
+		ids = append(ids, p.Id)
+	}
+
+	_, err = r.Session.DB("").C(pageEntryCollection).RemoveAll(bson.M{"page": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, dbError(err, "Page")
+	}
+
+	// the auto-detected incidents go with the pages, the manual ones only forget them
+	incidents := r.Session.DB("").C(incidentCollection)
+	_, err = incidents.RemoveAll(bson.M{"auto": true, "pages": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, dbError(err, "Page")
+	}
+	_, err = incidents.UpdateAll(bson.M{"pages": bson.M{"$in": ids}}, bson.M{"$pull": bson.M{"pages": bson.M{"$in": ids}}})
+	if err != nil {
+		return 0, dbError(err, "Page")
+	}
+
+	info, err := r.collection().RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, dbError(err, "Page")
+	}
+
+	return info.Removed, nil
 }
 
 // unexported methods
@@ -142,19 +415,285 @@ func (repo *PageRepository) collection() *mgo.Collection {
 	return repo.Session.DB("").C(pageCollection)
 }
 
+// updateError tells apart the page which doesn't exist and the page changed by someone else (its version moved on)
+func (r *PageRepository) updateError(err error, id bson.ObjectId) error {
+	if err != mgo.ErrNotFound {
+		return dbError(err, "Page")
+	}
+
+	n, err := r.collection().Find(r.scope(bson.M{"_id": id, "deleted_at": bson.M{"$exists": false}})).Count()
+	if err != nil {
+		return dbError(err, "Page")
+	}
+	if n > 0 {
+		return ErrPageChanged
+	}
+
+	return notFound("Page")
+}
+
+// versionQuery matches the version; the pages saved before the versions were introduced have none, which is 0
+func versionQuery(version int) interface{} {
+	if version == 0 {
+		return bson.M{"$in": []interface{}{0, nil}}
+	}
+
+	return version
+}
+
+func (repo *PageRepository) scope(q bson.M) bson.M {
+	return scope(q, "project", repo.Projects)
+}
+
+// checkContactGroups rejects the contact groups of the page which are not in its project, so the page can't
+// notify the people of the other projects
+func (r *PageRepository) checkContactGroups(page *Page) error {
+	if len(page.ContactGroups) == 0 {
+		return nil
+	}
+
+	found := []bson.ObjectId{}
+	if page.Project != "" {
+		err := r.Session.DB("").C(contactGroupCollection).
+			Find(bson.M{"_id": bson.M{"$in": page.ContactGroups}, "project": page.Project}).
+			Distinct("_id", &found)
+		if err != nil {
+			return dbError(err, "Contact group")
+		}
+	}
+
+	inProject := map[bson.ObjectId]bool{}
+	for _, id := range found {
+		inProject[id] = true
+	}
+
+	v := &validator{}
+	for i, id := range page.ContactGroups {
+		if !inProject[id] {
+			v.add("contact_groups/"+strconv.Itoa(i), "Contact group "+id.Hex()+" is not in the project of the page")
+		}
+	}
+
+	return v.err()
+}
+
 type Page struct {
 	DocumentBase  `bson:",inline"`
-	Name          string    `json:"name"`
-	Description   string    `json:"description"`
-	Url           string    `json:"url"`
-	RescueUrl     string    `json:"rescue_url,omitempty"`
-	Interval      int       `json:"interval"`
-	LastStatus    int       `json:"laststatus" bson:"laststatus"`
-	DesiredStatus int       `json:"desiredstatus" bson:"desiredstatus"`
-	Content       string    `json:"content" bson:"content"`
-	Disabled      bool      `json:"disabled" bson:"disabled"`
-	NextPing      time.Time `json:"nextPing" bson:"nextPing"`
+	Name          string             `json:"name"`
+	Slug          string             `json:"slug,omitempty" bson:"slug,omitempty"` // stable identifier for the imports
+	Version       int                `json:"version" bson:"version"`               // incremented by every change of the definition (the ETag)
+	Description   string             `json:"description"`
+	Url           string             `json:"url"`
+	RescueUrl     string             `json:"rescue_url,omitempty"`
+	Interval      int                `json:"interval"`
+	LastStatus    int                `json:"laststatus" bson:"laststatus"`
+	DesiredStatus int                `json:"desiredstatus" bson:"desiredstatus"`
+	Content       string             `json:"content" bson:"content"`
+	Disabled      bool               `json:"disabled" bson:"disabled"`
+	NextPing      time.Time          `json:"nextPing" bson:"nextPing"`
+	Checked       time.Time          `json:"checked" bson:"checked"`                           // when the last check was made
+	LastLoad      float64            `json:"lastload" bson:"lastload"`                         // how long the last check took (seconds)
+	TLSExpiry     *time.Time         `json:"tls_expiry,omitempty" bson:"tls_expiry,omitempty"` // when the certificate seen by the last check expires
+	Type          string             `json:"type" bson:"type"`
+	GRPC          *GRPCCheck         `json:"grpc,omitempty" bson:"grpc,omitempty"`
+	Steps         []Step             `json:"steps,omitempty" bson:"steps,omitempty"`
+	StatusPage    *StatusPageCheck   `json:"statuspage,omitempty" bson:"statuspage,omitempty"`
+	Latency       []LatencyAssertion `json:"latency,omitempty" bson:"latency,omitempty"`
+	CreatedBy     string             `json:"created_by" bson:"created_by"`
+	ModifiedBy    string             `json:"modified_by" bson:"modified_by"`
+	Project       bson.ObjectId      `json:"project,omitempty" bson:"project,omitempty"`
+	ContactGroups []bson.ObjectId    `json:"contact_groups,omitempty" bson:"contact_groups,omitempty"`
+	Tags          []string           `json:"tags,omitempty" bson:"tags,omitempty"`
+	Group         string             `json:"group,omitempty" bson:"group,omitempty"`
+	Locations     []string           `json:"locations,omitempty" bson:"locations,omitempty"` // the probes which check the page; all of them if empty
+	Quorum        int                `json:"quorum,omitempty" bson:"quorum,omitempty"`       // how many locations must fail for the page to be down; the majority if 0
+	Probes        ProbeStates        `json:"probes,omitempty" bson:"probes,omitempty"`       // the last check of every probe
+	Checks        int                `json:"checks" bson:"checks"`                           // all the checks ever made, by all the probes
+	ChecksUp      int                `json:"checks_up" bson:"checks_up"`                     // the successful ones
+	DeletedAt     *time.Time         `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+
+	// content change (defacement) detection, only for the successful responses
+	ContentCheck    *ContentCheck `json:"content_check,omitempty" bson:"content_check,omitempty"`
+	ContentHash     string        `json:"content_hash,omitempty" bson:"content_hash,omitempty"`
+	ContentSnapshot string        `json:"content_snapshot,omitempty" bson:"content_snapshot,omitempty"`
+}
+
+// clearState resets the state of the checker (everything but the definition, see the patchable), so the page
+// starts as never checked
+func (p *Page) clearState() {
+	p.LastStatus = 0
+	p.Content = ""
+	p.NextPing = time.Time{}
+	p.Checked = time.Time{}
+	p.LastLoad = 0
+	p.TLSExpiry = nil
+	p.Probes = nil
+	p.Checks = 0
+	p.ChecksUp = 0
+	p.DeletedAt = nil
+	p.ContentHash = ""
+	p.ContentSnapshot = ""
 }
+
+// ContentCheck defines which part of the response body is watched for the changes.
+// With no Selector and no Regex the whole body is watched
+type ContentCheck struct {
+	Selector  string  `json:"selector,omitempty" bson:"selector,omitempty"` // css selector of the watched region
+	Regex     string  `json:"regex,omitempty" bson:"regex,omitempty"`       // the first match (or its first group) is watched
+	Threshold float64 `json:"threshold" bson:"threshold"`                   // 0-1 similarity below which we alert; 0 means any change
+	Snapshot  bool    `json:"snapshot" bson:"snapshot"`                     // keep the normalized content to send the diff
+}
+
+// LatencyAssertion fails the successful check when the phase (dns, connect, tls, ttfb, transfer or total)
+// takes longer than Max seconds
+type LatencyAssertion struct {
+	Phase string  `json:"phase" bson:"phase"`
+	Max   float64 `json:"max" bson:"max"`
+}
+
+// GRPCCheck keeps the settings of the grpc.health.v1.Health/Check probe.
+// For this type of the check the page Url is the target address (host:port)
+type GRPCCheck struct {
+	Service  string            `json:"service" bson:"service"`
+	TLS      bool              `json:"tls" bson:"tls"`
+	Insecure bool              `json:"insecure" bson:"insecure"` // skip the certificate verification
+	Metadata map[string]string `json:"metadata,omitempty" bson:"metadata,omitempty"`
+}
+
+// StatusPageCheck reads the status of a third-party provider from its public status page api.
+// Supported formats: "statuspage" (Atlassian Statuspage /api/v2/status.json, the default) and "instatus" (/summary.json)
+type StatusPageCheck struct {
+	Format string `json:"format" bson:"format"`
+	DownAt string `json:"down_at" bson:"down_at"` // the indicator (minor, major, critical) from which the page is down; major by default
+}
+
+// Page statuses used by the PageFilter
+const (
+	StatusUp      = "up"
+	StatusDown    = "down"
+	StatusPaused  = "paused"
+	StatusDeleted = "deleted"
+)
+
+// PageFilter narrows down the list of pages; the empty fields are not taken into account
+type PageFilter struct {
+	Tags   []string // the page must have all of them
+	Group  string
+	Status string // up, down, paused or deleted
+	Search string // part of the name, url or description
+
+	Limit  int      // 0 means no limit
+	Offset int      //
+	Sort   string   // name, status, checked or created; -name for the descending order
+	Fields []string // json names of the fields to return, all (but the content) if empty
+}
+
+// the sort options of the PageFilter and their db fields
+var pageSorts = map[string]string{
+	"name":    "name",
+	"status":  "laststatus",
+	"checked": "checked",
+	"created": "_created",
+}
+
+// ValidPageSort tells if the PageFilter can sort by it; the empty sort is the default one
+func ValidPageSort(sort string) bool {
+	_, ok := pageSorts[strings.TrimPrefix(sort, "-")]
+
+	return sort == "" || ok
+}
+
+// ValidPageField tells if the page has the field of the json name, so the PageFilter can select it
+func ValidPageField(field string) bool {
+	_, ok := pageFields[field]
+
+	return ok
+}
+
+// pageFields maps the json names of the Page fields onto their bson names
+var pageFields = func() map[string]string {
+	fields := map[string]string{}
+
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Anonymous {
+				add(f.Type)
+				continue
+			}
+
+			j := strings.Split(f.Tag.Get("json"), ",")[0]
+			b := strings.Split(f.Tag.Get("bson"), ",")[0]
+			if j == "-" || b == "-" {
+				continue
+			}
+			if j == "" {
+				j = f.Name
+			}
+			if b == "" {
+				b = strings.ToLower(f.Name)
+			}
+
+			fields[j] = b
+		}
+	}
+	add(reflect.TypeOf(Page{}))
+
+	return fields
+}()
+
+// selection returns the fields to select from the db
+func (f PageFilter) selection() bson.M {
+	sel := bson.M{}
+
+	for _, field := range f.Fields {
+		if b, ok := pageFields[field]; ok {
+			sel[b] = 1
+		}
+	}
+
+	if len(sel) == 0 {
+		return bson.M{"content": 0, "content_snapshot": 0}
+	}
+
+	return sel
+}
+
+func (f PageFilter) query() bson.M {
+	q := bson.M{}
+
+	if len(f.Tags) > 0 {
+		q["tags"] = bson.M{"$all": f.Tags}
+	}
+	if f.Group != "" {
+		q["group"] = f.Group
+	}
+
+	// the deleted pages are listed only when asked for
+	q["deleted_at"] = bson.M{"$exists": false}
+
+	switch f.Status {
+	case StatusDeleted:
+		q["deleted_at"] = bson.M{"$exists": true}
+	case StatusUp:
+		q["disabled"] = false
+		q["$expr"] = pageUp
+	case StatusDown:
+		q["disabled"] = false
+		q["$expr"] = bson.M{"$not": []interface{}{pageUp}}
+	case StatusPaused:
+		q["disabled"] = true
+	}
+
+	if f.Search != "" {
+		re := bson.RegEx{Pattern: regexp.QuoteMeta(f.Search), Options: "i"}
+		q["$or"] = []bson.M{{"name": re}, {"url": re}, {"description": re}}
+	}
+
+	return q
+}
+
 type SinglePage struct {
 	Data Page `json:"data"`
 }
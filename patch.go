@@ -0,0 +1,106 @@
+package ping
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// patchable are the (json) fields of the page definition which can be patched; the runtime state
+// belongs to the checker
+var patchable = map[string]bool{
+	"name": true, "slug": true, "description": true, "url": true, "rescue_url": true, "interval": true,
+	"desiredstatus": true, "disabled": true, "type": true, "grpc": true, "steps": true, "statuspage": true,
+	"latency": true, "content_check": true, "project": true, "contact_groups": true, "tags": true, "group": true,
+	"locations": true, "quorum": true,
+}
+
+// PagePatch are the fields to change, by their json names; the fields which are not there stay as they are
+type PagePatch map[string]json.RawMessage
+
+type SinglePagePatch struct {
+	Data PagePatch `json:"data"`
+}
+
+// ApplyPatch sets the fields of the patch on the page and returns them by their bson names, the way definition
+// does: the fields to $set and the emptied omitempty ones (eg. "project": null) to $unset. The whole field is
+// replaced, eg. the patched steps are all the steps of the page
+func (p *Page) ApplyPatch(patch PagePatch) (set, unset bson.M, err error) {
+	v := &validator{}
+	set, unset = bson.M{}, bson.M{}
+
+	pv := reflect.ValueOf(p).Elem()
+	t := pv.Type()
+
+	for name, raw := range patch {
+		if !patchable[name] {
+			v.add(name, "Field "+name+" cannot be patched")
+			continue
+		}
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if tagName(f.Tag.Get("json")) != name {
+				continue
+			}
+
+			// decoded into a new value, so nothing is merged with the old one
+			val := reflect.New(f.Type)
+			if err := json.Unmarshal(raw, val.Interface()); err != nil {
+				v.add(name, "Field "+name+" must be "+f.Type.String())
+				break
+			}
+
+			pv.Field(i).Set(val.Elem())
+
+			key := tagName(f.Tag.Get("bson"))
+			if key == "" {
+				key = strings.ToLower(f.Name)
+			}
+			if val.Elem().IsZero() && strings.Contains(f.Tag.Get("bson"), ",omitempty") {
+				unset[key] = ""
+				break
+			}
+			set[key] = val.Elem().Interface()
+
+			break
+		}
+	}
+
+	return set, unset, v.err()
+}
+
+// definition returns the patchable fields of the page by their bson names, the way Update saves them: the fields
+// to $set and the empty omitempty ones to $unset, as if the whole page was saved
+func (p *Page) definition() (set, unset bson.M) {
+	set, unset = bson.M{}, bson.M{}
+
+	pv := reflect.ValueOf(p).Elem()
+	t := pv.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !patchable[tagName(f.Tag.Get("json"))] {
+			continue
+		}
+
+		key := tagName(f.Tag.Get("bson"))
+		if key == "" {
+			key = strings.ToLower(f.Name)
+		}
+		if pv.Field(i).IsZero() && strings.Contains(f.Tag.Get("bson"), ",omitempty") {
+			unset[key] = ""
+			continue
+		}
+		set[key] = pv.Field(i).Interface()
+	}
+
+	return set, unset
+}
+
+// tagName is the name part of the struct tag, eg. "url" of "url,omitempty"
+func tagName(tag string) string {
+	return strings.Split(tag, ",")[0]
+}
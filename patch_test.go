@@ -0,0 +1,66 @@
+package ping
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestApplyPatch(t *testing.T) {
+	project := bson.NewObjectId()
+
+	tests := []struct {
+		name  string
+		patch PagePatch
+		set   []string
+		unset []string
+	}{
+		{"name", PagePatch{"name": []byte(`"Home"`)}, []string{"name"}, nil},
+		{"empty project", PagePatch{"project": []byte(`""`)}, nil, []string{"project"}},
+		{"null project", PagePatch{"project": []byte(`null`)}, nil, []string{"project"}},
+		{"project", PagePatch{"project": []byte(`"` + project.Hex() + `"`)}, []string{"project"}, nil},
+		{"null tags", PagePatch{"tags": []byte(`null`)}, nil, []string{"tags"}},
+		// zero without omitempty is a value, it's set
+		{"enabled", PagePatch{"disabled": []byte(`false`)}, []string{"disabled"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := &Page{Name: "Old", Project: bson.NewObjectId(), Tags: []string{"old"}, Disabled: true}
+
+			set, unset, err := page.ApplyPatch(tt.patch)
+			if err != nil {
+				t.Fatalf("ApplyPatch() error = %v", err)
+			}
+			if len(set) != len(tt.set) || len(unset) != len(tt.unset) {
+				t.Fatalf("ApplyPatch() = %v, %v, want to set %v and unset %v", set, unset, tt.set, tt.unset)
+			}
+			for _, k := range tt.set {
+				if _, ok := set[k]; !ok {
+					t.Errorf("ApplyPatch() doesn't set %s", k)
+				}
+			}
+			for _, k := range tt.unset {
+				if _, ok := unset[k]; !ok {
+					t.Errorf("ApplyPatch() doesn't unset %s", k)
+				}
+			}
+
+			// what mgo would get
+			if _, err := bson.Marshal(bson.M{"$set": set, "$unset": unset}); err != nil {
+				t.Errorf("ApplyPatch() change cannot be encoded: %v", err)
+			}
+		})
+	}
+}
+
+func TestApplyPatchNotPatchable(t *testing.T) {
+	page := &Page{}
+
+	_, _, err := page.ApplyPatch(PagePatch{"laststatus": []byte(`200`), "interval": []byte(`"often"`)})
+
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Fields) != 2 {
+		t.Errorf("ApplyPatch() error = %v, want the errors of both fields", err)
+	}
+}
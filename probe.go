@@ -0,0 +1,86 @@
+package ping
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultProbe is the name of the probe when the checker runs in one location only
+const DefaultProbe = "default"
+
+// the state of a probe older than that many intervals of the page is not counted (eg. the probe was stopped)
+const probeStaleIntervals = 3
+
+// ProbeState is the last check of the page made by one probe (location)
+type ProbeState struct {
+	Code     int       `json:"code" bson:"code"`
+	Load     float64   `json:"load" bson:"load"`
+	Checked  time.Time `json:"checked" bson:"checked"`
+	NextPing time.Time `json:"nextPing" bson:"nextPing"`
+}
+
+// ProbeStates are the states of the probes by their names
+type ProbeStates map[string]ProbeState
+
+// ValidProbeName tells if the name can be the name of a probe; it's a key of the Probes in the db,
+// so it can't have the dots and the dollars
+func ValidProbeName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, ".$")
+}
+
+// QuorumStatus is the status of the page by the latest checks of its locations (all the probes which ever checked it
+// when the page has no Locations). The page is down when at least Quorum (the majority by default) of the locations
+// fail (see the Up); its status is then the code of the first failing location, otherwise the code of the first
+// successful one. When fewer than Quorum locations report (eg. a new page or the stopped probes) nothing is decided
+// and ok is false
+func (p *Page) QuorumStatus(now time.Time) (code int, ok bool) {
+	names := append([]string{}, p.Locations...)
+	if len(names) == 0 {
+		for name := range p.Probes {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	quorum := p.Quorum
+	if quorum == 0 {
+		quorum = len(names)/2 + 1
+	}
+
+	interval := p.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	stale := time.Duration(probeStaleIntervals*interval) * time.Minute
+
+	reporting, failing, upCode, downCode := 0, 0, 0, 0
+	for _, name := range names {
+		st, ok := p.Probes[name]
+		if !ok || now.Sub(st.Checked) > stale {
+			continue
+		}
+
+		reporting++
+		if p.Up(st.Code) {
+			if upCode == 0 {
+				upCode = st.Code
+			}
+			continue
+		}
+
+		failing++
+		if failing == 1 {
+			downCode = st.Code
+		}
+	}
+
+	if reporting < quorum {
+		return 0, false
+	}
+	if failing < quorum {
+		return upCode, true
+	}
+
+	return downCode, true
+}
@@ -0,0 +1,55 @@
+package ping
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuorumStatus(t *testing.T) {
+	now := time.Now()
+	fresh := func(code int) ProbeState { return ProbeState{Code: code, Checked: now.Add(-time.Minute)} }
+	stale := func(code int) ProbeState { return ProbeState{Code: code, Checked: now.Add(-time.Hour)} }
+
+	three := []string{"dc1", "dc2", "office"}
+
+	tests := []struct {
+		name      string
+		locations []string
+		quorum    int
+		desired   int
+		probes    ProbeStates
+		code      int
+		ok        bool
+	}{
+		{"none of 3 reporting", three, 0, 0, ProbeStates{}, 0, false},
+		{"1 of 3 reporting, failing", three, 0, 0, ProbeStates{"office": fresh(503)}, 0, false},
+		{"1 of 3 reporting, up", three, 0, 0, ProbeStates{"office": fresh(200)}, 0, false},
+		{"2 of 3 reporting, 1 failing", three, 0, 0, ProbeStates{"office": fresh(503), "dc1": fresh(200)}, 200, true},
+		{"2 of 3 reporting, both failing", three, 0, 0, ProbeStates{"office": fresh(503), "dc1": fresh(500)}, 500, true},
+		{"3 of 3 reporting, 1 failing", three, 0, 0, ProbeStates{"office": fresh(503), "dc1": fresh(200), "dc2": fresh(200)}, 200, true},
+		{"3 of 3 reporting, 2 failing", three, 0, 0, ProbeStates{"office": fresh(503), "dc1": fresh(200), "dc2": fresh(502)}, 502, true},
+		{"3 of 3 reporting, all up", three, 0, 0, ProbeStates{"office": fresh(200), "dc1": fresh(200), "dc2": fresh(200)}, 200, true},
+		{"stale states don't report", three, 0, 0, ProbeStates{"office": fresh(503), "dc1": stale(500), "dc2": stale(500)}, 0, false},
+		{"stale and fresh", three, 0, 0, ProbeStates{"office": fresh(503), "dc1": fresh(500), "dc2": stale(200)}, 500, true},
+		{"probe out of the locations", three, 0, 0, ProbeStates{"office": fresh(503), "home": fresh(503)}, 0, false},
+		{"quorum 1 of 3", three, 1, 0, ProbeStates{"office": fresh(503)}, 503, true},
+		{"quorum 3 of 3, 2 failing", three, 3, 0, ProbeStates{"office": fresh(503), "dc1": fresh(500), "dc2": fresh(200)}, 200, true},
+		{"quorum 3 of 3, 2 reporting", three, 3, 0, ProbeStates{"office": fresh(503), "dc1": fresh(500)}, 0, false},
+		{"quorum 3 of 3, all failing", three, 3, 0, ProbeStates{"office": fresh(503), "dc1": fresh(500), "dc2": fresh(500)}, 500, true},
+		{"no locations, single probe", nil, 0, 0, ProbeStates{DefaultProbe: fresh(404)}, 404, true},
+		{"desired status, 2 of 3 up", three, 0, 201, ProbeStates{"office": fresh(201), "dc1": fresh(201), "dc2": fresh(200)}, 201, true},
+		{"desired status, 2 of 3 with 200", three, 0, 201, ProbeStates{"office": fresh(201), "dc1": fresh(200), "dc2": fresh(200)}, 200, true},
+		{"no locations, known probes", nil, 0, 0, ProbeStates{"a": fresh(503), "b": stale(200), "c": stale(200)}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Page{Interval: 5, Locations: tt.locations, Quorum: tt.quorum, DesiredStatus: tt.desired, Probes: tt.probes}
+
+			code, ok := p.QuorumStatus(now)
+			if code != tt.code || ok != tt.ok {
+				t.Errorf("QuorumStatus() = %d, %v; want %d, %v", code, ok, tt.code, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package ping
+
+import (
+	"strconv"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	projectCollection = "projects"
+)
+
+// IProjectRepository exposes the methods for the ProjectRepository
+type IProjectRepository interface {
+	Projects() ([]*Project, error)
+	Create(*Project) error
+	Delete(ID string) error
+	Close()
+}
+
+// ProjectRepository works only with the projects of the given Ids; nil means all of them (admins, the checker)
+type ProjectRepository struct {
+	Session *mgo.Session
+	Ids     []bson.ObjectId
+}
+
+func (repo *ProjectRepository) Close() {
+	repo.Session.Close()
+}
+
+// Project (organization, team) owns the pages, the contact groups and the api keys
+type Project struct {
+	DocumentBase `bson:",inline"`
+	Name         string `json:"name" bson:"name"`
+	Slug         string `json:"slug" bson:"slug"`
+}
+type SingleProject struct {
+	Data Project `json:"data"`
+}
+
+func (r *ProjectRepository) Projects() (projects []*Project, err error) {
+	err = r.collection().Find(scope(bson.M{}, "_id", r.Ids)).Sort("name").All(&projects)
+
+	return projects, dbError(err, "Project")
+}
+
+func (r *ProjectRepository) Create(project *Project) error {
+	if project.Name == "" {
+		return invalid("Project cannot be created without the name")
+	}
+	if project.Slug == "" {
+		project.Slug = Slugify(project.Name)
+	}
+
+	n, err := r.collection().Find(bson.M{"slug": project.Slug}).Count()
+	if err != nil {
+		return dbError(err, "Project")
+	}
+	if n > 0 {
+		return duplicate("Project already exist")
+	}
+
+	project.Id = bson.NewObjectId()
+
+	return dbError(r.collection().Insert(project), "Project")
+}
+
+// Delete removes the project which owns nothing; its pages (also the deleted ones, they can be restored), contact
+// groups and active api keys have to be removed (or moved) first
+func (r *ProjectRepository) Delete(id string) error {
+	oid, err := objectId(id, "Project")
+	if err != nil {
+		return err
+	}
+
+	n, err := r.collection().Find(scope(bson.M{"_id": oid}, "_id", r.Ids)).Count()
+	if err != nil {
+		return dbError(err, "Project")
+	}
+	if n == 0 {
+		return notFound("Project")
+	}
+
+	db := r.collection().Database
+	for _, ref := range []struct {
+		collection, what string
+		q                bson.M
+	}{
+		{pageCollection, "pages", bson.M{"project": oid}},
+		{contactGroupCollection, "contact groups", bson.M{"project": oid}},
+		{apiKeyCollection, "api keys", bson.M{"project": oid, "revoked": false}},
+	} {
+		n, err := db.C(ref.collection).Find(ref.q).Count()
+		if err != nil {
+			return dbError(err, "Project")
+		}
+		if n > 0 {
+			return duplicate("Project still has " + strconv.Itoa(n) + " " + ref.what)
+		}
+	}
+
+	return dbError(r.collection().Remove(scope(bson.M{"_id": oid}, "_id", r.Ids)), "Project")
+}
+
+// unexported methods
+func (repo *ProjectRepository) collection() *mgo.Collection {
+	return repo.Session.DB("").C(projectCollection)
+}
+
+// scope limits the query to the documents of the given projects (the field keeps the project id). nil projects means no limits
+func scope(q bson.M, field string, projects []bson.ObjectId) bson.M {
+	if projects == nil {
+		return q
+	}
+
+	if _, ok := q[field]; ok {
+		// eg. a single document by its id, both conditions have to match
+		return bson.M{"$and": []bson.M{q, {field: bson.M{"$in": projects}}}}
+	}
+
+	q[field] = bson.M{"$in": projects}
+
+	return q
+}
+
+// inProjects tells if the project is one of the allowed ones
+func inProjects(project bson.ObjectId, projects []bson.ObjectId) bool {
+	if projects == nil {
+		return true
+	}
+
+	for _, p := range projects {
+		if p == project {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,5 +1,84 @@
 package ping
 
+import (
+	"errors"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
 const (
 	DBName = "ping"
 )
+
+// Kinds of the repository errors. Every error returned by the repositories matches (errors.Is) one of them
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrDuplicate  = errors.New("duplicate")
+	ErrValidation = errors.New("validation failed")
+	ErrStale      = errors.New("stale version")
+	ErrStorage    = errors.New("storage failure")
+)
+
+// Error is the error of a repository: its Kind, the message which can be shown to the user and the cause
+// (eg. the mgo error) which should only be logged
+type Error struct {
+	Kind error
+	Msg  string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Msg + ": " + e.Err.Error()
+	}
+
+	return e.Msg
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+
+	return []error{e.Kind}
+}
+
+func notFound(what string) error {
+	return &Error{Kind: ErrNotFound, Msg: what + " not found"}
+}
+
+func duplicate(msg string) error {
+	return &Error{Kind: ErrDuplicate, Msg: msg}
+}
+
+func invalid(msg string) error {
+	return &Error{Kind: ErrValidation, Msg: msg}
+}
+
+// dbError turns the mgo error about the what (Page, User...) into the repository error
+func dbError(err error, what string) error {
+	var e *Error
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &e):
+		return err
+	case err == mgo.ErrNotFound:
+		return notFound(what)
+	case mgo.IsDup(err):
+		return &Error{Kind: ErrDuplicate, Msg: what + " already exist", Err: err}
+	}
+
+	return &Error{Kind: ErrStorage, Msg: "Cannot access the storage", Err: err}
+}
+
+// objectId parses the id of the what; a malformed id can't match anything, so it's not found
+func objectId(id, what string) (bson.ObjectId, error) {
+	if !bson.IsObjectIdHex(id) {
+		return "", notFound(what)
+	}
+
+	return bson.ObjectIdHex(id), nil
+}
@@ -0,0 +1,32 @@
+package ping
+
+// Step is a single request of the scenario check. The Url, Headers and Body may contain {{name}} placeholders
+// which are replaced with the values extracted by the previous steps
+type Step struct {
+	Name     string            `json:"name" bson:"name"`
+	Method   string            `json:"method" bson:"method"`
+	Url      string            `json:"url" bson:"url"`
+	Headers  map[string]string `json:"headers,omitempty" bson:"headers,omitempty"`
+	Body     string            `json:"body,omitempty" bson:"body,omitempty"`
+	Status   int               `json:"status" bson:"status"`                         // expected status code, 200 if not set
+	Contains string            `json:"contains,omitempty" bson:"contains,omitempty"` // the response body must contain it
+	Extract  []Extract         `json:"extract,omitempty" bson:"extract,omitempty"`
+}
+
+// Extract keeps a value from the step response under the Name, so the next steps can use it as {{Name}}
+type Extract struct {
+	Name string `json:"name" bson:"name"`
+	From string `json:"from" bson:"from"` // header, cookie or json
+	Key  string `json:"key" bson:"key"`   // header/cookie name or a dotted json path (eg. data.token or items.0.id)
+}
+
+// StepResult is what happened during a single step of the scenario; stored with the PageEntry
+type StepResult struct {
+	Name   string  `json:"name" bson:"name"`
+	Url    string  `json:"url" bson:"url"`
+	Code   int     `json:"code" bson:"code"`
+	Load   float64 `json:"load" bson:"load"`
+	Passed bool    `json:"passed" bson:"passed"`
+	Error  string  `json:"error,omitempty" bson:"error,omitempty"`
+	Timing *Timing `json:"timing,omitempty" bson:"timing,omitempty"`
+}
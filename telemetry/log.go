@@ -0,0 +1,114 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// NewLogger returns the JSON logger of the app (name is the name of its log file: ping, http).
+//
+// The logs go to PING_LOG_FILE and to the stdout; "-" means the stdout only, log/<name>.log by default.
+// PING_LOG_LEVEL is debug, info (default), warn or error. The errors are written to PING_ERR_LOG as well
+// (log/err.log by default, "-" turns it off), so there is one place to look for the problems of both apps.
+// The returned closer closes the log files
+func NewLogger(name string) (*slog.Logger, io.Closer, error) {
+	files := closers{}
+
+	out := io.Writer(os.Stdout)
+	if path := env("PING_LOG_FILE", "log/"+name+".log"); path != "-" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, f)
+		out = io.MultiWriter(f, os.Stdout)
+	}
+
+	level := slog.LevelInfo
+	if err := level.UnmarshalText([]byte(env("PING_LOG_LEVEL", "info"))); err != nil {
+		return nil, nil, err
+	}
+
+	handlers := multiHandler{slog.NewJSONHandler(out, &slog.HandlerOptions{Level: level})}
+
+	if path := env("PING_ERR_LOG", "log/err.log"); path != "-" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			files.Close()
+			return nil, nil, err
+		}
+		files = append(files, f)
+		handlers = append(handlers, slog.NewJSONHandler(f, &slog.HandlerOptions{Level: slog.LevelError}))
+	}
+
+	return slog.New(handlers).With("app", name), files, nil
+}
+
+func env(name, def string) string {
+	if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+		return v
+	}
+
+	return def
+}
+
+// multiHandler passes the records to all the handlers which accept their level
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	for _, h := range m {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+		if e := h.Handle(ctx, r.Clone()); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := multiHandler{}
+	for _, h := range m {
+		handlers = append(handlers, h.WithAttrs(attrs))
+	}
+
+	return handlers
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := multiHandler{}
+	for _, h := range m {
+		handlers = append(handlers, h.WithGroup(name))
+	}
+
+	return handlers
+}
+
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var err error
+	for _, f := range c {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,58 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StartTracing sends the spans to the OTLP/HTTP collector of OTEL_EXPORTER_OTLP_ENDPOINT (eg. http://localhost:4318);
+// the rest of the standard OTEL_* envs (headers, OTEL_SERVICE_NAME...) work as well. Without the endpoint the spans
+// are not recorded at all. The returned func sends the remaining spans, call it before the exit
+func StartTracing(service string) (shutdown func() error, err error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func() error { return nil }, nil
+	}
+
+	ctx := context.Background()
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", service)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	shutdown = func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		return provider.Shutdown(ctx)
+	}
+
+	return shutdown, nil
+}
+
+// Tracer is the tracer of the ping spans
+func Tracer() trace.Tracer {
+	return otel.Tracer("github.com/tomekwlod/ping")
+}
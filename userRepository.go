@@ -0,0 +1,232 @@
+package ping
+
+import (
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	userCollection    = "users"
+	sessionCollection = "sessions"
+
+	sessionPrefix = "sess_"
+	sessionTTL    = 24 * time.Hour
+)
+
+// User roles, each one can do everything the previous one can
+const (
+	RoleViewer = "viewer" // read only
+	RoleEditor = "editor" // can modify the pages
+	RoleAdmin  = "admin"  // manages the users, the api keys and the notifications
+)
+
+// ErrInvalidLogin is the same for an unknown user and a wrong password
+var ErrInvalidLogin = &Error{Kind: ErrValidation, Msg: "Invalid username or password"}
+
+var roleLevels = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// RoleAllows tells if the role is enough for something which requires the other role
+func RoleAllows(role, required string) bool {
+	return roleLevels[role] > 0 && roleLevels[role] >= roleLevels[required]
+}
+
+// IUserRepository exposes the methods for the UserRepository, including the login sessions of the users
+type IUserRepository interface {
+	Users() ([]*User, error)
+	Count() (int, error)
+	Create(*User) error
+	Delete(ID string) error
+	Login(username, password string) (token string, user *User, err error)
+	FindByToken(token string) (*User, error)
+	Logout(token string) error
+	Close()
+}
+
+type UserRepository struct {
+	Session *mgo.Session
+}
+
+func (repo *UserRepository) Close() {
+	repo.Session.Close()
+}
+
+// User keeps only the bcrypt hash of the password; the plain one is accepted in the json only when creating the user
+type User struct {
+	DocumentBase  `bson:",inline"`
+	Username      string          `json:"username" bson:"username"`
+	PlainPassword string          `json:"password,omitempty" bson:"-"`
+	Password      string          `json:"-" bson:"password"`
+	Role          string          `json:"role" bson:"role"`
+	Projects      []bson.ObjectId `json:"projects" bson:"projects"` // admins see all the projects
+}
+
+// AllowedProjects returns the projects the user can work with; nil means all of them
+func (u *User) AllowedProjects() []bson.ObjectId {
+	if u.Role == RoleAdmin {
+		return nil
+	}
+	if u.Projects == nil {
+		return []bson.ObjectId{}
+	}
+
+	return u.Projects
+}
+
+type SingleUser struct {
+	Data User `json:"data"`
+}
+
+// UserSession is a login session, the token itself is not stored, only its hash
+type UserSession struct {
+	Id      bson.ObjectId `bson:"_id"`
+	Hash    string        `bson:"hash"`
+	User    bson.ObjectId `bson:"user"`
+	Expires time.Time     `bson:"expires"`
+}
+
+func (r *UserRepository) Users() (users []*User, err error) {
+	err = r.collection().Find(nil).Sort("username").All(&users)
+
+	return users, dbError(err, "User")
+}
+
+func (r *UserRepository) Count() (int, error) {
+	n, err := r.collection().Count()
+
+	return n, dbError(err, "User")
+}
+
+func (r *UserRepository) Create(user *User) error {
+	if user.Username == "" || user.PlainPassword == "" {
+		return invalid("User cannot be created without the username and the password")
+	}
+	if user.Role == "" {
+		user.Role = RoleViewer
+	}
+	if _, ok := roleLevels[user.Role]; !ok {
+		return invalid("Unknown role " + user.Role)
+	}
+
+	n, err := r.collection().Find(bson.M{"username": user.Username}).Count()
+	if err != nil {
+		return dbError(err, "User")
+	}
+	if n > 0 {
+		return duplicate("User already exist")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.PlainPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	user.Id = bson.NewObjectId()
+	user.Password = string(hash)
+	user.PlainPassword = ""
+
+	return dbError(r.collection().Insert(user), "User")
+}
+
+// Delete removes the user and all the user sessions. The last admin stays (even when deleting oneself),
+// otherwise nobody could manage the users any more
+func (r *UserRepository) Delete(id string) error {
+	oid, err := objectId(id, "User")
+	if err != nil {
+		return err
+	}
+
+	user := &User{}
+	err = r.collection().FindId(oid).One(user)
+	if err != nil {
+		return dbError(err, "User")
+	}
+	if user.Role == RoleAdmin {
+		n, err := r.collection().Find(bson.M{"role": RoleAdmin}).Count()
+		if err != nil {
+			return dbError(err, "User")
+		}
+		if n <= 1 {
+			return duplicate("The last admin cannot be deleted")
+		}
+	}
+
+	err = r.collection().RemoveId(oid)
+	if err != nil {
+		return dbError(err, "User")
+	}
+
+	_, err = r.sessions().RemoveAll(bson.M{"user": oid})
+
+	return dbError(err, "Session")
+}
+
+// Login checks the password and opens a new session; the returned token is valid for 24h
+func (r *UserRepository) Login(username, password string) (token string, user *User, err error) {
+	user = &User{}
+	err = r.collection().Find(bson.M{"username": username}).One(user)
+	if err == mgo.ErrNotFound {
+		return "", nil, ErrInvalidLogin
+	}
+	if err != nil {
+		return "", nil, dbError(err, "User")
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return "", nil, ErrInvalidLogin
+	}
+
+	token, err = newToken(sessionPrefix)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = r.sessions().Insert(&UserSession{
+		Id:      bson.NewObjectId(),
+		Hash:    HashToken(token),
+		User:    user.Id,
+		Expires: time.Now().Add(sessionTTL),
+	})
+	if err != nil {
+		return "", nil, dbError(err, "Session")
+	}
+
+	return token, user, nil
+}
+
+// FindByToken returns the user of the active session
+func (r *UserRepository) FindByToken(token string) (*User, error) {
+	session := &UserSession{}
+	err := r.sessions().Find(bson.M{"hash": HashToken(token), "expires": bson.M{"$gt": time.Now()}}).One(session)
+	if err != nil {
+		return nil, dbError(err, "Session")
+	}
+
+	user := &User{}
+	err = r.collection().FindId(session.User).One(user)
+	if err != nil {
+		return nil, dbError(err, "User")
+	}
+
+	return user, nil
+}
+
+func (r *UserRepository) Logout(token string) error {
+	_, err := r.sessions().RemoveAll(bson.M{"hash": HashToken(token)})
+
+	return dbError(err, "Session")
+}
+
+// unexported methods
+func (repo *UserRepository) collection() *mgo.Collection {
+	return repo.Session.DB("").C(userCollection)
+}
+func (repo *UserRepository) sessions() *mgo.Collection {
+	return repo.Session.DB("").C(sessionCollection)
+}
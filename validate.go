@@ -0,0 +1,274 @@
+package ping
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// the bounds of the page interval (minutes)
+const (
+	MinInterval = 1
+	MaxInterval = 24 * 60
+)
+
+// FieldError is the problem with one field of the input. Field is the path of the field in the json of the page,
+// separated by slashes (eg. "steps/0/url"), so it can be used as a JSON pointer
+type FieldError struct {
+	Field string `json:"field"`
+	Msg   string `json:"message"`
+}
+
+// ValidationError lists all the problems found in the input; it's an ErrValidation
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := []string{}
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Msg)
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// validator collects the field errors
+type validator struct {
+	fields []FieldError
+}
+
+func (v *validator) add(field, msg string) {
+	v.fields = append(v.fields, FieldError{Field: field, Msg: msg})
+}
+
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Fields: v.fields}
+}
+
+// Validate checks the definition of the page (the runtime state set by the checker is not checked),
+// so the broken pages never get to the db
+func (p *Page) Validate() error {
+	v := &validator{}
+
+	switch p.Type {
+	case "", CheckHTTP, CheckStatusPage:
+		v.httpUrl("url", "Url", p.Url, true)
+	case CheckGRPC:
+		v.address("url", p.Url)
+	case CheckScenario:
+		if p.Url == "" {
+			v.add("url", "Url is required")
+		}
+		if len(p.Steps) == 0 {
+			v.add("steps", "Scenario must have at least one step")
+		}
+	default:
+		v.add("type", "Type must be "+CheckHTTP+", "+CheckGRPC+", "+CheckScenario+" or "+CheckStatusPage)
+	}
+
+	v.httpUrl("rescue_url", "Rescue url", p.RescueUrl, false)
+
+	if p.Interval < MinInterval || p.Interval > MaxInterval {
+		v.add("interval", "Interval must be between "+strconv.Itoa(MinInterval)+" and "+strconv.Itoa(MaxInterval)+" minutes")
+	}
+	v.statusCode("desiredstatus", "Desired status", p.DesiredStatus)
+
+	seen := map[string]bool{}
+	for i, l := range p.Locations {
+		if !ValidProbeName(l) {
+			v.add("locations/"+strconv.Itoa(i), "Location must be the name of a probe, without the dots and the dollars")
+		}
+		if seen[l] {
+			v.add("locations/"+strconv.Itoa(i), "Location "+l+" is listed more than once")
+		}
+		seen[l] = true
+	}
+	if p.Quorum < 0 || len(p.Locations) > 0 && p.Quorum > len(p.Locations) {
+		v.add("quorum", "Quorum must be between 0 (the majority) and the number of the locations")
+	}
+
+	if p.Project != "" && !p.Project.Valid() {
+		v.add("project", "Project must be an ObjectId")
+	}
+	// the groups being in the project of the page is checked by the repository, see the checkContactGroups
+	for i, g := range p.ContactGroups {
+		if !g.Valid() {
+			v.add("contact_groups/"+strconv.Itoa(i), "Contact group must be an ObjectId")
+		}
+	}
+
+	if p.GRPC != nil {
+		for k, val := range p.GRPC.Metadata {
+			if !validMetadataKey(k) {
+				v.add("grpc/metadata/"+k, "Metadata key "+k+" must be lowercase letters, digits, '-', '_' or '.'")
+			}
+			if strings.ContainsAny(val, "\r\n") {
+				v.add("grpc/metadata/"+k, "Metadata value of "+k+" cannot contain the line breaks")
+			}
+		}
+	}
+
+	for i, s := range p.Steps {
+		v.step("steps/"+strconv.Itoa(i), s)
+	}
+
+	if p.StatusPage != nil {
+		if f := p.StatusPage.Format; f != "" && f != "statuspage" && f != "instatus" {
+			v.add("statuspage/format", "Status page format must be statuspage or instatus")
+		}
+		if d := p.StatusPage.DownAt; d != "" && d != "minor" && d != "major" && d != "critical" {
+			v.add("statuspage/down_at", "Status page down_at must be minor, major or critical")
+		}
+	}
+
+	if c := p.ContentCheck; c != nil {
+		if c.Regex != "" {
+			if _, err := regexp.Compile(c.Regex); err != nil {
+				v.add("content_check/regex", "Content check regex is not valid: "+err.Error())
+			}
+		}
+		if c.Threshold < 0 || c.Threshold > 1 {
+			v.add("content_check/threshold", "Content check threshold must be between 0 and 1")
+		}
+	}
+
+	for i, a := range p.Latency {
+		f := "latency/" + strconv.Itoa(i)
+		if _, ok := (&Timing{}).Phase(a.Phase); !ok && a.Phase != "total" {
+			v.add(f+"/phase", "Latency phase must be dns, connect, tls, ttfb, transfer or total")
+		} else if p.Type == CheckGRPC && a.Phase != "total" {
+			// the grpc call has no http phases
+			v.add(f+"/phase", "Latency phase of the grpc check must be total")
+		}
+		if a.Max <= 0 {
+			v.add(f+"/max", "Latency max must be a positive number of seconds")
+		}
+	}
+
+	return v.err()
+}
+
+func (v *validator) step(field string, s Step) {
+	// the placeholders are known only when the scenario runs
+	if !strings.Contains(s.Url, "{{") {
+		v.httpUrl(field+"/url", "Step url", s.Url, true)
+	}
+
+	if s.Method != "" && !validToken(s.Method) {
+		v.add(field+"/method", "Step method "+s.Method+" is not valid")
+	}
+	v.statusCode(field+"/status", "Step status", s.Status)
+
+	for k, val := range s.Headers {
+		if !validToken(k) {
+			v.add(field+"/headers/"+k, "Header name "+k+" is not valid")
+		}
+		if strings.ContainsAny(val, "\r\n") {
+			v.add(field+"/headers/"+k, "Header "+k+" cannot contain the line breaks")
+		}
+	}
+
+	for i, e := range s.Extract {
+		f := field + "/extract/" + strconv.Itoa(i)
+		if e.Name == "" {
+			v.add(f+"/name", "Extract name is required")
+		}
+		if e.From != "header" && e.From != "cookie" && e.From != "json" {
+			v.add(f+"/from", "Extract from must be header, cookie or json")
+		}
+		if e.Key == "" {
+			v.add(f+"/key", "Extract key is required")
+		}
+	}
+}
+
+// httpUrl checks the absolute http(s) url; the empty one only when it's not required
+func (v *validator) httpUrl(field, name, raw string, required bool) {
+	if raw == "" {
+		if required {
+			v.add(field, name+" is required")
+		}
+
+		return
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		v.add(field, name+" is not a valid url")
+
+		return
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		v.add(field, name+" must use the http or https scheme")
+	}
+	if u.Host == "" {
+		v.add(field, name+" must have the host")
+	}
+}
+
+// address checks the host:port of the grpc target
+func (v *validator) address(field, raw string) {
+	if raw == "" {
+		v.add(field, "Url is required")
+
+		return
+	}
+
+	_, port, err := net.SplitHostPort(raw)
+	if err != nil {
+		v.add(field, "Url of the grpc check must be host:port")
+
+		return
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		v.add(field, "Url of the grpc check must have a port between 1 and 65535")
+	}
+}
+
+// statusCode checks the http status code; 0 means not set
+func (v *validator) statusCode(field, name string, code int) {
+	if code != 0 && (code < 100 || code > 599) {
+		v.add(field, name+" must be between 100 and 599")
+	}
+}
+
+// validToken tells if s is the token of RFC 7230 (the header names and the methods)
+func validToken(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		if c > 127 || !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validMetadataKey tells if s can be the key of the grpc metadata
+func validMetadataKey(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+
+	return true
+}